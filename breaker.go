@@ -0,0 +1,102 @@
+package httprateredis
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned while the circuit breaker is open and FailMode
+// is FailClosed.
+var ErrCircuitOpen = errors.New("redis circuit breaker is open")
+
+// FailMode decides how calls are answered when Redis fails or the circuit
+// breaker is open, and there is no local fallback.
+type FailMode int
+
+const (
+	// FailClosed returns the Redis error, or ErrCircuitOpen, so httprate
+	// rejects the request
+	FailClosed FailMode = iota
+	// FailOpen counts nothing and reports zero, so the request is allowed
+	FailOpen
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker short-circuits Redis calls after threshold consecutive failures
+// within window, then lets a single probe through once cooldown has passed.
+// A nil breaker always allows calls.
+type breaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	mu           sync.Mutex
+	state        breakerState
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+}
+
+// allow reports whether a call may go to Redis
+func (b *breaker) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// a probe is already in flight
+		return false
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of a call it allowed
+func (b *breaker) record(now time.Time, err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+		b.openedAt = now
+		return
+	}
+
+	if b.failures == 0 || (b.window > 0 && now.Sub(b.firstFailure) > b.window) {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = now
+		b.failures = 0
+	}
+}
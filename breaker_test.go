@@ -0,0 +1,161 @@
+package httprateredis
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerProbeSurvivesRejectedAcquire(t *testing.T) {
+	c, _ := newTestCounter(t, &Config{
+		BreakerThreshold: 1,
+		MaxConcurrentOps: 1,
+		OverloadMode:     OverloadReject,
+	})
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	// open the breaker with its cooldown already over, so the next call probes
+	c.breaker.state = breakerOpen
+	c.breaker.openedAt = now.Add(-time.Hour)
+
+	c.sem <- struct{}{}
+	if err := c.Increment("key", now); !errors.Is(err, ErrTooManyOps) {
+		t.Fatalf("Increment with no free slot = %v, want ErrTooManyOps", err)
+	}
+	if _, _, err := c.Get("key", now, now.Add(-time.Minute)); !errors.Is(err, ErrTooManyOps) {
+		t.Fatalf("Get with no free slot = %v, want ErrTooManyOps", err)
+	}
+	<-c.sem
+
+	if err := c.Increment("key", now); err != nil {
+		t.Fatalf("Increment after freeing the slot: %v", err)
+	}
+	if c.breaker.state != breakerClosed {
+		t.Errorf("breaker state = %v after a successful probe, want closed", c.breaker.state)
+	}
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	now := time.Now()
+	b := &breaker{threshold: 2, cooldown: time.Second}
+	failure := errors.New("connection refused")
+
+	b.record(now, failure)
+	if !b.allow(now) {
+		t.Fatal("breaker opened below its threshold")
+	}
+	b.record(now, failure)
+	if b.allow(now) {
+		t.Fatal("breaker didn't open at its threshold")
+	}
+	if b.allow(now.Add(500 * time.Millisecond)) {
+		t.Fatal("breaker let a call through during its cooldown")
+	}
+
+	// once the cooldown is over a single probe goes through
+	probe := now.Add(time.Second)
+	if !b.allow(probe) {
+		t.Fatal("breaker didn't probe after its cooldown")
+	}
+	if b.allow(probe) {
+		t.Fatal("breaker let a second call through while probing")
+	}
+
+	// a failed probe reopens it for another cooldown
+	b.record(probe, failure)
+	if b.allow(probe.Add(500 * time.Millisecond)) {
+		t.Fatal("breaker let a call through after a failed probe")
+	}
+
+	recovered := probe.Add(time.Second)
+	if !b.allow(recovered) {
+		t.Fatal("breaker didn't probe again")
+	}
+	b.record(recovered, nil)
+	if !b.allow(recovered) || !b.allow(recovered) {
+		t.Fatal("breaker didn't close after a successful probe")
+	}
+}
+
+func TestBreakerWindow(t *testing.T) {
+	now := time.Now()
+	b := &breaker{threshold: 2, window: time.Second, cooldown: time.Second}
+	failure := errors.New("connection refused")
+
+	// failures further apart than the window aren't consecutive
+	b.record(now, failure)
+	b.record(now.Add(2*time.Second), failure)
+	if !b.allow(now.Add(2 * time.Second)) {
+		t.Fatal("breaker opened on failures outside its window")
+	}
+	b.record(now.Add(2500*time.Millisecond), failure)
+	if b.allow(now.Add(2500 * time.Millisecond)) {
+		t.Fatal("breaker didn't open on failures within its window")
+	}
+}
+
+func TestBreakerShortCircuits(t *testing.T) {
+	c, mr := newTestCounter(t, &Config{
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Hour,
+		Timeout:          200 * time.Millisecond,
+	})
+	now := time.Now().UTC().Truncate(time.Minute)
+	mr.Close()
+
+	if err := c.Increment("key", now); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Increment with Redis down = %v, want the Redis error", err)
+	}
+	if err := c.Increment("key", now); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Increment with the breaker open = %v, want ErrCircuitOpen", err)
+	}
+	if _, _, err := c.Get("key", now, now.Add(-time.Minute)); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Get with the breaker open = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestFallbackToLocalLeavesConfigUnchanged(t *testing.T) {
+	cfg := &Config{FallbackToLocal: true}
+	c, _ := newTestCounter(t, cfg)
+
+	if c.breaker == nil || c.breaker.threshold != 1 {
+		t.Errorf("breaker = %+v, want a threshold of 1 with FallbackToLocal", c.breaker)
+	}
+	if cfg.BreakerThreshold != 0 || cfg.PrefixKey != "" || cfg.Timeout != 0 || cfg.Clock != nil {
+		t.Errorf("defaults were written to the caller's config: %+v", cfg)
+	}
+}
+
+func TestFailMode(t *testing.T) {
+	for _, tt := range []struct {
+		mode FailMode
+		// wantErr is the error of the call failing in Redis, and of the
+		// ones the open breaker answers after it
+		wantErr, wantOpenErr error
+	}{
+		{FailClosed, errBroken, ErrCircuitOpen},
+		{FailOpen, nil, nil},
+	} {
+		var reported []error
+		c := newRedisLimitCounter(failingClient(t), &Config{
+			FailMode:         tt.mode,
+			BreakerThreshold: 1,
+			BreakerCooldown:  time.Hour,
+			OnError:          func(err error) { reported = append(reported, err) },
+		})
+		c.Config(10, time.Minute)
+		now := time.Now().UTC().Truncate(time.Minute)
+
+		if err := c.Increment("key", now); !errors.Is(err, tt.wantErr) {
+			t.Errorf("mode %d: Increment = %v, want %v", tt.mode, err, tt.wantErr)
+		}
+		curr, prev, err := c.Get("key", now, now.Add(-time.Minute))
+		if !errors.Is(err, tt.wantOpenErr) || curr != 0 || prev != 0 {
+			t.Errorf("mode %d: Get = %d, %d, %v, want 0, 0, %v", tt.mode, curr, prev, err, tt.wantOpenErr)
+		}
+		// the failure is reported in either mode
+		if len(reported) != 1 || !errors.Is(reported[0], errBroken) {
+			t.Errorf("mode %d: reported %v, want errBroken once", tt.mode, reported)
+		}
+	}
+}
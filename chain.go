@@ -0,0 +1,71 @@
+package httprateredis
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+// chainCounter tries each of its counters in order
+type chainCounter struct {
+	counters []httprate.LimitCounter
+}
+
+var _ httprate.LimitCounter = &chainCounter{}
+
+// ChainLimitCounter returns a LimitCounter that tries counters in order,
+// falling through to the next one whenever one fails, e.g. Redis, then a
+// second Redis, then httprate's in-memory counter:
+/*
+	local := httprate.NewRateLimiter(100, time.Minute).Counter()
+	httprate.WithLimitCounter(httprateredis.ChainLimitCounter(primary, secondary, local))
+*/
+// Each counter only counts the requests it served, so counts diverge
+// between backends: after falling through a key starts over from the
+// next counter's count, and its count on the failed counter is missing
+// those requests once it recovers. Counters that hide their own failures,
+// such as a RedisLimitCounter with FallbackToLocal or FailOpen, never fall
+// through.
+func ChainLimitCounter(counters ...httprate.LimitCounter) httprate.LimitCounter {
+	return &chainCounter{counters: counters}
+}
+
+func (c *chainCounter) Config(requestLimit int, windowLength time.Duration) {
+	for _, counter := range c.counters {
+		counter.Config(requestLimit, windowLength)
+	}
+}
+
+func (c *chainCounter) Increment(key string, currentWindow time.Time) error {
+	errs := make([]error, 0, len(c.counters))
+	for _, counter := range c.counters {
+		err := counter.Increment(key, currentWindow)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return chainError("increment", errs)
+}
+
+func (c *chainCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	errs := make([]error, 0, len(c.counters))
+	for _, counter := range c.counters {
+		curr, prev, err := counter.Get(key, currentWindow, previousWindow)
+		if err == nil {
+			return curr, prev, nil
+		}
+		errs = append(errs, err)
+	}
+	return 0, 0, chainError("get", errs)
+}
+
+// chainError returns the error of op failing on every counter of a chain
+func chainError(op string, errs []error) error {
+	if len(errs) == 0 {
+		return fmt.Errorf("chain %s failed: no counters", op)
+	}
+	return fmt.Errorf("chain %s failed on every counter: %w", op, errors.Join(errs...))
+}
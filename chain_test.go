@@ -0,0 +1,68 @@
+package httprateredis
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+func TestChainLimitCounter(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+	primary := newRedisLimitCounter(failingClient(t), &Config{})
+	secondary, mr := newTestCounter(t, nil)
+	chain := ChainLimitCounter(primary, secondary)
+	chain.Config(10, time.Minute)
+
+	// Config reaches every counter of the chain
+	if primary.RequestLimit() != 10 || secondary.WindowLength() != time.Minute {
+		t.Errorf("counters configured with %d, %v, want 10, 1m", primary.RequestLimit(), secondary.WindowLength())
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := chain.Increment("key", now); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+	if curr, _, err := chain.Get("key", now, prev); err != nil || curr != 2 {
+		t.Errorf("Get = %d, %v, want 2, nil", curr, err)
+	}
+	if got, _ := mr.Get(secondary.limitCounterKey("key", now)); got != "2" {
+		t.Errorf("secondary count = %q, want 2", got)
+	}
+
+	// with both Redis down, the local counter serves
+	down := newRedisLimitCounter(failingClient(t), &Config{})
+	local := httprate.NewRateLimiter(10, time.Minute).Counter()
+	chain = ChainLimitCounter(primary, down, local)
+	chain.Config(10, time.Minute)
+	if err := chain.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if curr, _, err := chain.Get("key", now, prev); err != nil || curr != 1 {
+		t.Errorf("local Get = %d, %v, want 1, nil", curr, err)
+	}
+}
+
+func TestChainLimitCounterFails(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	first := newRedisLimitCounter(failingClient(t), &Config{})
+	second := newRedisLimitCounter(failingClient(t), &Config{})
+	chain := ChainLimitCounter(first, second)
+	chain.Config(10, time.Minute)
+
+	err := chain.Increment("key", now)
+	if !errors.Is(err, errBroken) || !strings.HasPrefix(err.Error(), "chain increment failed on every counter: ") {
+		t.Errorf("Increment = %v, want the errors of every counter", err)
+	}
+	if _, _, err := chain.Get("key", now, now.Add(-time.Minute)); !errors.Is(err, errBroken) {
+		t.Errorf("Get = %v, want errBroken", err)
+	}
+
+	if err := ChainLimitCounter().Increment("key", now); err == nil || err.Error() != "chain increment failed: no counters" {
+		t.Errorf("Increment of an empty chain = %v", err)
+	}
+}
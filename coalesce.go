@@ -0,0 +1,59 @@
+package httprateredis
+
+import (
+	"sync"
+	"time"
+)
+
+// coalescer buffers increments of the same key for CoalesceWindow, so that
+// they're sent to Redis as one INCRBY
+type coalescer struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	pending map[coalesceKey]*coalesced
+}
+
+type coalesceKey struct {
+	key          string
+	window       int64
+	windowLength time.Duration
+}
+
+// coalesced is a buffered increment waiting to be flushed
+type coalesced struct {
+	currentWindow time.Time
+	n             int64
+}
+
+// coalesce adds n to the buffered increment of key, scheduling a flush if
+// there is none yet. Flushes count as in-flight operations for Shutdown.
+func (c *RedisLimitCounter) coalesce(key string, currentWindow time.Time, windowLength time.Duration, n int64) error {
+	co := c.coalescer
+	ck := coalesceKey{key: key, window: currentWindow.UnixNano(), windowLength: windowLength}
+
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	if pending, ok := co.pending[ck]; ok {
+		pending.n += n
+		return nil
+	}
+	if !c.drain.begin() {
+		return ErrShuttingDown
+	}
+	co.pending[ck] = &coalesced{currentWindow: currentWindow, n: n}
+
+	time.AfterFunc(co.window, func() {
+		defer c.drain.end()
+
+		co.mu.Lock()
+		pending := co.pending[ck]
+		delete(co.pending, ck)
+		co.mu.Unlock()
+
+		// failures are reported by incrementNow
+		c.incrementNow(c.ctx, key, pending.currentWindow, windowLength, pending.n)
+	})
+	return nil
+}
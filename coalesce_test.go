@@ -0,0 +1,73 @@
+package httprateredis
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rueian/rueidis/mock"
+)
+
+func TestCoalesceWindow(t *testing.T) {
+	client := mock.NewClient(gomock.NewController(t))
+	// gomock fails the test on any further increment
+	client.EXPECT().Do(gomock.Any(), mock.MatchFn(func(cmd []string) bool {
+		return cmd[0] == "EVALSHA" && cmd[5] == "50"
+	}, "increment by 50")).Return(mock.Result(mock.RedisInt64(50)))
+
+	c := newRedisLimitCounter(client, &Config{CoalesceWindow: 200 * time.Millisecond})
+	c.Config(100, time.Minute)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Increment("key", now); err != nil {
+				t.Errorf("Increment: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	c.drain.inflight.Wait()
+}
+
+func TestCoalesceWindowCount(t *testing.T) {
+	c, mr := newTestCounter(t, &Config{CoalesceWindow: 200 * time.Millisecond})
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	for i := 0; i < 5; i++ {
+		if err := c.Increment("key", now); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+	// an increment of another key or window is flushed separately
+	if err := c.Increment("other", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if err := c.Increment("key", now.Add(-time.Minute)); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+
+	// nothing is written until the window ends
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("keys written before the flush: %v", keys)
+	}
+	c.drain.inflight.Wait()
+
+	for _, tt := range []struct {
+		key    string
+		window time.Time
+		want   string
+	}{
+		{"key", now, "5"},
+		{"other", now, "1"},
+		{"key", now.Add(-time.Minute), "1"},
+	} {
+		if got, _ := mr.Get(c.limitCounterKey(tt.key, tt.window)); got != tt.want {
+			t.Errorf("count of %s at %v = %q, want %s", tt.key, tt.window, got, tt.want)
+		}
+	}
+}
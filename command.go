@@ -0,0 +1,40 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCommandTimeout is returned when a single Redis command takes longer
+// than CommandTimeout. Unlike the overall Timeout, a Get can retry it.
+var ErrCommandTimeout = errors.New("redis command timed out")
+
+// CommandMetricsHook is a MetricsHook that also observes every Redis
+// command, e.g. to tell which of them is slow.
+type CommandMetricsHook interface {
+	MetricsHook
+	// ObserveCommand is called after every Redis command
+	ObserveCommand(command string, duration time.Duration, err error)
+}
+
+// commandContext bounds a single Redis command by CommandTimeout
+func (c *RedisLimitCounter) commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.cmdTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.cmdTimeout)
+}
+
+// observeCommand reports a command started at start to the metrics hook,
+// and attributes its error to CommandTimeout if cmdCtx expired before ctx
+func (c *RedisLimitCounter) observeCommand(ctx, cmdCtx context.Context, command string, start time.Time, err error) error {
+	if hook, ok := c.metrics.(CommandMetricsHook); ok {
+		hook.ObserveCommand(command, time.Since(start), err)
+	}
+	if err != nil && ctx.Err() == nil && errors.Is(cmdCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s took over %v", ErrCommandTimeout, command, c.cmdTimeout)
+	}
+	return err
+}
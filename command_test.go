@@ -0,0 +1,73 @@
+package httprateredis
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// commandHook is a CommandMetricsHook recording the commands it's told about
+type commandHook struct {
+	metricsHook
+
+	mu       sync.Mutex
+	commands []string
+	errs     []error
+}
+
+func (h *commandHook) ObserveCommand(command string, _ time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.commands = append(h.commands, command)
+	h.errs = append(h.errs, err)
+}
+
+func TestCommandTimeout(t *testing.T) {
+	hook := &commandHook{}
+	c := newRedisLimitCounter(blockingClient(t), &Config{
+		Timeout:        time.Second,
+		CommandTimeout: 20 * time.Millisecond,
+		MaxRetries:     1,
+		RetryBackoff:   time.Millisecond,
+		Metrics:        hook,
+	})
+	c.Config(10, time.Minute)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	start := time.Now()
+	err := c.Increment("key", now)
+	if !errors.Is(err, ErrCommandTimeout) || !strings.Contains(err.Error(), "EVALSHA took over 20ms") {
+		t.Errorf("Increment = %v, want an EVALSHA ErrCommandTimeout", err)
+	}
+	_, _, err = c.Get("key", now, now.Add(-time.Minute))
+	if !errors.Is(err, ErrCommandTimeout) || !strings.Contains(err.Error(), "GET took over 20ms") {
+		t.Errorf("Get = %v, want a GET ErrCommandTimeout", err)
+	}
+	// each command gave up well before the overall Timeout
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("calls took %v", elapsed)
+	}
+
+	// the increment isn't retried once sent, the get is
+	if want := []string{"EVALSHA", "GET", "GET"}; !reflect.DeepEqual(hook.commands, want) {
+		t.Errorf("observed commands %v, want %v", hook.commands, want)
+	}
+	for i, err := range hook.errs {
+		if err == nil {
+			t.Errorf("command %d observed without its error", i)
+		}
+	}
+}
+
+func TestCommandTimeoutUnset(t *testing.T) {
+	c := newRedisLimitCounter(blockingClient(t), &Config{Timeout: 20 * time.Millisecond})
+	c.Config(10, time.Minute)
+
+	// the overall Timeout isn't mistaken for a command timeout
+	if err := c.Increment("key", time.Now()); errors.Is(err, ErrCommandTimeout) {
+		t.Errorf("Increment = %v, want the overall timeout", err)
+	}
+}
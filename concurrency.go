@@ -0,0 +1,52 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTooManyOps is returned when MaxConcurrentOps Redis operations are
+// already in flight and OverloadMode is OverloadReject.
+var ErrTooManyOps = errors.New("too many concurrent redis operations")
+
+// OverloadMode decides what happens to an Increment or Get issued while
+// MaxConcurrentOps operations are already in flight.
+type OverloadMode int
+
+const (
+	// OverloadQueue waits for an operation to finish, up to Timeout
+	OverloadQueue OverloadMode = iota
+	// OverloadReject returns ErrTooManyOps straight away
+	OverloadReject
+)
+
+// acquire takes one of the MaxConcurrentOps slots, it's a no-op when there
+// is no limit
+func (c *RedisLimitCounter) acquire(ctx context.Context) error {
+	if c.sem == nil {
+		return nil
+	}
+
+	if c.overloadMode == OverloadReject {
+		select {
+		case c.sem <- struct{}{}:
+			return nil
+		default:
+			return ErrTooManyOps
+		}
+	}
+
+	select {
+	case c.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by acquire
+func (c *RedisLimitCounter) release() {
+	if c.sem != nil {
+		<-c.sem
+	}
+}
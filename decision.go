@@ -0,0 +1,19 @@
+package httprateredis
+
+// DecisionMetricsHook is a MetricsHook that is also told whether each
+// request checked against a limit was allowed, so that block rates can be
+// graphed directly. Decisions are reported for every Get made by httprate's
+// middleware, and for Allow, AllowWeighted and CheckAll.
+type DecisionMetricsHook interface {
+	MetricsHook
+	// ObserveDecision is called once per request checked against a limit
+	ObserveDecision(allowed bool)
+}
+
+// observeDecision reports a limit decision to Metrics if it is a
+// DecisionMetricsHook
+func (c *RedisLimitCounter) observeDecision(allowed bool) {
+	if hook, ok := c.metrics.(DecisionMetricsHook); ok {
+		hook.ObserveDecision(allowed)
+	}
+}
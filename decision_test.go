@@ -0,0 +1,72 @@
+package httprateredis
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+// decisionHook is a DecisionMetricsHook recording the decisions it's told
+// about
+type decisionHook struct {
+	metricsHook
+
+	mu        sync.Mutex
+	decisions []bool
+}
+
+func (h *decisionHook) ObserveDecision(allowed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.decisions = append(h.decisions, allowed)
+}
+
+func TestObserveDecision(t *testing.T) {
+	hook := &decisionHook{}
+	c, _ := newTestCounter(t, &Config{Metrics: hook})
+	// an hour long window, so that the test doesn't cross into the next one
+	h := httprate.Limit(3, time.Hour, httprate.WithLimitCounter(c))(okHandler)
+
+	var codes []int
+	for i := 0; i < 5; i++ {
+		codes = append(codes, serve(h))
+	}
+	if want := []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}; !reflect.DeepEqual(codes, want) {
+		t.Fatalf("responses = %v, want %v", codes, want)
+	}
+	if want := []bool{true, true, true, false, false}; !reflect.DeepEqual(hook.decisions, want) {
+		t.Errorf("decisions = %v, want %v", hook.decisions, want)
+	}
+}
+
+func TestObserveDecisionAllow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	hook := &decisionHook{}
+	c, _ := newTestCounter(t, &Config{ClusterMode: true, Metrics: hook, Clock: func() time.Time { return now }})
+
+	for i := 0; i < 3; i++ {
+		c.Allow("job", 2, time.Second)
+	}
+	// a window later the previous one still weighs half
+	now = start.Add(1500 * time.Millisecond)
+	c.Allow("job", 2, time.Second)
+	c.Allow("job", 2, time.Second)
+	if want := []bool{true, true, false, true, false}; !reflect.DeepEqual(hook.decisions, want) {
+		t.Errorf("decisions = %v, want %v", hook.decisions, want)
+	}
+
+	// failures aren't decisions
+	c = newRedisLimitCounter(failingClient(t), &Config{Metrics: hook})
+	hook.decisions = nil
+	if _, err := c.Allow("job", 2, time.Second); err == nil {
+		t.Fatal("Allow on a failing client succeeded")
+	}
+	if len(hook.decisions) != 0 {
+		t.Errorf("decisions = %v, want none", hook.decisions)
+	}
+}
@@ -0,0 +1,53 @@
+package httprateredis
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ConfigFromEnv returns a Config read from the following environment
+// variables, leaving the defaults for any that are unset:
+// * REDIS_ADDRESSES, comma separated host/ports
+// * REDIS_USERNAME
+// * REDIS_PASSWORD
+// * REDIS_DB_INDEX
+// * REDIS_TLS, true to enable TLS
+func ConfigFromEnv() (*Config, error) {
+	cfg := &Config{}
+
+	if v, ok := os.LookupEnv("REDIS_ADDRESSES"); ok {
+		for _, addr := range strings.Split(v, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				cfg.Addresses = append(cfg.Addresses, addr)
+			}
+		}
+	}
+
+	if v, ok := os.LookupEnv("REDIS_USERNAME"); ok {
+		cfg.Username = v
+	}
+
+	if v, ok := os.LookupEnv("REDIS_PASSWORD"); ok {
+		cfg.Password = v
+	}
+
+	if v, ok := os.LookupEnv("REDIS_DB_INDEX"); ok && v != "" {
+		index, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_DB_INDEX %q: %w", v, err)
+		}
+		cfg.DBIndex = index
+	}
+
+	if v, ok := os.LookupEnv("REDIS_TLS"); ok && v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_TLS %q: %w", v, err)
+		}
+		cfg.EnableTLS = enabled
+	}
+
+	return cfg, nil
+}
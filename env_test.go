@@ -0,0 +1,59 @@
+package httprateredis
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("REDIS_ADDRESSES", "10.0.0.1:6379, 10.0.0.2:6379,,")
+	t.Setenv("REDIS_USERNAME", "limiter")
+	t.Setenv("REDIS_PASSWORD", "secret")
+	t.Setenv("REDIS_DB_INDEX", "3")
+	t.Setenv("REDIS_TLS", "true")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv: %v", err)
+	}
+	want := &Config{
+		Addresses: []string{"10.0.0.1:6379", "10.0.0.2:6379"},
+		Username:  "limiter",
+		Password:  "secret",
+		DBIndex:   3,
+		EnableTLS: true,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("ConfigFromEnv = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestConfigFromEnvUnset(t *testing.T) {
+	for _, name := range []string{"REDIS_ADDRESSES", "REDIS_USERNAME", "REDIS_PASSWORD"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	// empty numbers and booleans are treated as unset
+	t.Setenv("REDIS_DB_INDEX", "")
+	t.Setenv("REDIS_TLS", "")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, &Config{}) {
+		t.Errorf("ConfigFromEnv = %+v, want a zero Config", cfg)
+	}
+}
+
+func TestConfigFromEnvInvalid(t *testing.T) {
+	for name, value := range map[string]string{"REDIS_DB_INDEX": "one", "REDIS_TLS": "maybe"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := ConfigFromEnv(); err == nil {
+				t.Errorf("%s=%s was accepted", name, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rueian/rueidis"
+)
+
+var (
+	// ErrConnection wraps errors reaching Redis, like failed dials, timeouts,
+	// closed connections and unavailable cluster slots.
+	ErrConnection = errors.New("redis connection error")
+	// ErrCommand wraps errors Redis returned for a command, like a failed
+	// script or a counter holding a non-integer value.
+	ErrCommand = errors.New("redis command error")
+)
+
+// classify wraps err in ErrConnection or ErrCommand, keeping the original
+// error matchable with errors.Is and errors.As. Missing keys and cancelled
+// contexts are returned as is.
+func classify(err error) error {
+	if err == nil || errors.Is(err, rueidis.Nil) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	var redisErr *rueidis.RedisError
+	if errors.As(err, &redisErr) && !redisErr.IsTryAgain() && !redisErr.IsClusterDown() {
+		return fmt.Errorf("%w: %w", ErrCommand, err)
+	}
+	return fmt.Errorf("%w: %w", ErrConnection, err)
+}
+
+// checkReplies returns an ErrCommand error unless a reply has want entries,
+// so that a truncated reply is reported rather than indexed out of range
+func checkReplies(got, want int) error {
+	if got != want {
+		return fmt.Errorf("%w: got %d replies, want %d", ErrCommand, got, want)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rueian/rueidis"
+	"github.com/rueian/rueidis/mock"
+)
+
+func TestClassify(t *testing.T) {
+	commandErr := mock.Result(mock.RedisError("ERR wrong type")).Error()
+	tests := []struct {
+		name string
+		err  error
+		want error // nil when err is returned as is
+	}{
+		{"command", commandErr, ErrCommand},
+		{"try again", mock.Result(mock.RedisError("TRYAGAIN retry")).Error(), ErrConnection},
+		{"cluster down", mock.Result(mock.RedisError("CLUSTERDOWN down")).Error(), ErrConnection},
+		{"dial", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, ErrConnection},
+		{"reset", io.EOF, ErrConnection},
+		{"deadline", context.DeadlineExceeded, ErrConnection},
+		{"closing", rueidis.ErrClosing, ErrConnection},
+		{"missing key", rueidis.Nil, nil},
+		{"canceled", context.Canceled, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classify(tt.err)
+			if tt.want == nil {
+				if got != tt.err {
+					t.Errorf("classify(%v) = %v, want it unchanged", tt.err, got)
+				}
+				return
+			}
+			if !errors.Is(got, tt.want) || !errors.Is(got, tt.err) {
+				t.Errorf("classify(%v) = %v, want it wrapped in %v", tt.err, got, tt.want)
+			}
+			if other := map[error]error{ErrCommand: ErrConnection, ErrConnection: ErrCommand}[tt.want]; errors.Is(got, other) {
+				t.Errorf("classify(%v) = %v, also matches %v", tt.err, got, other)
+			}
+		})
+	}
+
+	if classify(nil) != nil {
+		t.Error("classify(nil) isn't nil")
+	}
+	// the Redis error stays reachable with errors.As
+	var redisErr *rueidis.RedisError
+	if !errors.As(classify(commandErr), &redisErr) {
+		t.Error("a classified command error isn't a *rueidis.RedisError")
+	}
+	if err := checkReplies(1, 2); !errors.Is(err, ErrCommand) {
+		t.Errorf("checkReplies = %v, want ErrCommand", err)
+	}
+}
+
+func TestTruncatedReplies(t *testing.T) {
+	client := mock.NewClient(gomock.NewController(t))
+	// whatever is asked for, only a single reply comes back
+	client.EXPECT().DoMulti(gomock.Any(), gomock.Any()).Return([]rueidis.RedisResult{mock.Result(mock.RedisInt64(1))})
+	client.EXPECT().Do(gomock.Any(), gomock.Any()).Return(mock.Result(mock.RedisArray(mock.RedisInt64(1))))
+
+	c := newRedisLimitCounter(client, &Config{ClusterMode: true})
+	c.Config(10, time.Minute)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	if _, _, err := c.Get("key", now, now.Add(-time.Minute)); !errors.Is(err, ErrCommand) {
+		t.Errorf("Get = %v, want ErrCommand", err)
+	}
+	if _, _, err := c.IncrementAndGet("key", now, now.Add(-time.Minute)); !errors.Is(err, ErrCommand) {
+		t.Errorf("IncrementAndGet = %v, want ErrCommand", err)
+	}
+}
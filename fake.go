@@ -0,0 +1,94 @@
+package httprateredis
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+// FakeLimitCounter is an in-memory httprate.LimitCounter for testing
+// handlers without Redis. It keys and expires counters like
+// RedisLimitCounter does with the default config.
+type FakeLimitCounter struct {
+	// Clock returns the current time used to expire counters, defaults to time.Now
+	Clock func() time.Time
+
+	mu           sync.Mutex
+	counters     map[string]*fakeCount
+	requestLimit int
+	windowLength time.Duration
+}
+
+type fakeCount struct {
+	value     int
+	expiresAt time.Time
+}
+
+var _ httprate.LimitCounter = &FakeLimitCounter{}
+
+// NewFakeLimitCounter returns a new in-memory LimitCounter.
+func NewFakeLimitCounter() *FakeLimitCounter {
+	return &FakeLimitCounter{
+		Clock:    time.Now,
+		counters: make(map[string]*fakeCount),
+	}
+}
+
+// Config modifies the current config of the counter
+func (c *FakeLimitCounter) Config(requestLimit int, windowLength time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requestLimit = requestLimit
+	c.windowLength = windowLength
+}
+
+func (c *FakeLimitCounter) Increment(key string, currentWindow time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.windowLength <= 0 {
+		return errors.New("redis increment failed: counter is not configured")
+	}
+
+	now := c.Clock()
+	hkey := fakeCounterKey(key, currentWindow)
+
+	v, ok := c.counters[hkey]
+	if !ok || !now.Before(v.expiresAt) {
+		// expired from the window start, like expiryMillis does
+		v = &fakeCount{expiresAt: currentWindow.Add(c.windowLength * DefaultExpiryMultiplier)}
+		c.counters[hkey] = v
+	}
+	v.value++
+
+	return nil
+}
+
+func (c *FakeLimitCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.Clock()
+	return c.value(fakeCounterKey(key, currentWindow), now), c.value(fakeCounterKey(key, previousWindow), now), nil
+}
+
+// value returns the unexpired count stored at hkey
+func (c *FakeLimitCounter) value(hkey string, now time.Time) int {
+	v, ok := c.counters[hkey]
+	if !ok {
+		return 0
+	}
+	if !now.Before(v.expiresAt) {
+		delete(c.counters, hkey)
+		return 0
+	}
+	return v.value
+}
+
+// fakeCounterKey returns the key RedisLimitCounter would store the counter at
+func fakeCounterKey(key string, window time.Time) string {
+	return fmt.Sprintf("%s%d", DefaultPrefix, httprate.LimitCounterKey(key, window))
+}
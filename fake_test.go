@@ -0,0 +1,88 @@
+package httprateredis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeLimitCounterExpiresFromWindowStart(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start.Add(50 * time.Second)
+	c := NewFakeLimitCounter()
+	c.Clock = func() time.Time { return now }
+	c.Config(10, time.Minute)
+
+	// first incremented late in its window, the counter still expires three
+	// window lengths after the window started
+	if err := c.Increment("key", start); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+
+	now = start.Add(3*time.Minute - time.Second)
+	if curr, _, _ := c.Get("key", start, start.Add(-time.Minute)); curr != 1 {
+		t.Errorf("count just before expiry = %d, want 1", curr)
+	}
+	now = start.Add(3 * time.Minute)
+	if curr, _, _ := c.Get("key", start, start.Add(-time.Minute)); curr != 0 {
+		t.Errorf("count at expiry = %d, want 0", curr)
+	}
+}
+
+func TestFakeLimitCounterMatchesRedis(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start.Add(20 * time.Second)
+	rc, mr := newTestCounter(t, &Config{Clock: fixedClock(now)})
+	fake := NewFakeLimitCounter()
+	fake.Clock = fixedClock(now)
+	fake.Config(10, time.Minute)
+
+	if err := rc.Increment("key", start); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if err := fake.Increment("key", start); err != nil {
+		t.Fatalf("fake Increment: %v", err)
+	}
+
+	hkey := fakeCounterKey("key", start)
+	if !mr.Exists(hkey) {
+		t.Fatalf("the fake's key %s isn't the key Redis is incremented at", hkey)
+	}
+	if got, want := fake.counters[hkey].expiresAt.Sub(now), mr.TTL(hkey); got != want {
+		t.Errorf("fake expires in %v, Redis in %v", got, want)
+	}
+}
+
+func TestFakeLimitCounterWindowBoundary(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	c := NewFakeLimitCounter()
+	c.Clock = func() time.Time { return now }
+	c.Config(10, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if err := c.Increment("key", start); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+
+	// in the next window the count moves to the previous window
+	now = start.Add(time.Minute)
+	next := start.Add(time.Minute)
+	if err := c.Increment("key", next); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	curr, prev, err := c.Get("key", next, start)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if curr != 1 || prev != 3 {
+		t.Errorf("Get = %d, %d, want 1, 3", curr, prev)
+	}
+
+	// two windows on, the first window is neither current nor previous
+	now = start.Add(2 * time.Minute)
+	curr, prev, err = c.Get("key", start.Add(2*time.Minute), next)
+	if err != nil || curr != 0 || prev != 1 {
+		t.Errorf("Get = %d, %d, %v, want 0, 1, nil", curr, prev, err)
+	}
+}
@@ -0,0 +1,53 @@
+package httprateredis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFallbackToLocalAndRecovery(t *testing.T) {
+	c, mr := newTestCounter(t, &Config{
+		FallbackToLocal: true,
+		BreakerCooldown: 50 * time.Millisecond,
+		Timeout:         200 * time.Millisecond,
+	})
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+
+	mr.Close()
+	for i := 0; i < 3; i++ {
+		if err := c.Increment("key", now); err != nil {
+			t.Fatalf("Increment with Redis down: %v", err)
+		}
+	}
+	curr, _, err := c.Get("key", now, prev)
+	if err != nil {
+		t.Fatalf("Get with Redis down: %v", err)
+	}
+	if curr != 3 {
+		t.Errorf("local count = %d, want 3", curr)
+	}
+
+	if err := mr.Restart(); err != nil {
+		t.Fatalf("restarting miniredis: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	// once the cooldown is over, a probe reaches Redis and closes the breaker
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := c.Increment("key", now); err != nil {
+			t.Fatalf("Increment after recovery: %v", err)
+		}
+		if mr.Exists(c.limitCounterKey("key", now)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("increments never reached Redis again")
+		}
+		time.Sleep(60 * time.Millisecond)
+	}
+	if c.breaker.state != breakerClosed {
+		t.Errorf("breaker state = %v after recovery, want closed", c.breaker.state)
+	}
+}
@@ -0,0 +1,82 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rueian/rueidis"
+)
+
+// functionLibrary is the Redis 7 function library of incrementScript and
+// incrementFieldScript, called with FCALL when UseFunctions is set.
+const functionLibrary = `#!lua name=httprate
+
+local function increment(keys, args)
+	local count = redis.call('INCRBY', keys[1], args[2])
+	if redis.call('PTTL', keys[1]) == -1 then
+		redis.call('PEXPIRE', keys[1], args[1])
+	end
+	return count
+end
+
+local function increment_field(keys, args)
+	local count = redis.call('HINCRBY', keys[1], args[3], args[2])
+	if redis.call('PTTL', keys[1]) == -1 then
+		redis.call('PEXPIRE', keys[1], args[1])
+	end
+	return count
+end
+
+redis.register_function('httprate_increment', increment)
+redis.register_function('httprate_increment_field', increment_field)
+`
+
+// loadFunctions loads functionLibrary on every master if they all report
+// running Redis 7+, and leaves increments on EVALSHA otherwise. Replicas
+// refuse FUNCTION LOAD, and get the library from their master.
+func (c *RedisLimitCounter) loadFunctions(ctx context.Context) error {
+	nodes, err := masterNodes(ctx, c.client)
+	if err != nil {
+		return err
+	}
+	for addr, node := range nodes {
+		info, err := node.Do(ctx, node.B().Info().Section("server").Build()).ToString()
+		var redisErr *rueidis.RedisError
+		if errors.As(err, &redisErr) {
+			// servers without INFO server sections predate functions too
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("redis info on %s failed: %w", addr, classify(err))
+		}
+		if major, ok := redisMajorVersion(info); !ok || major < 7 {
+			return nil
+		}
+	}
+
+	for addr, node := range nodes {
+		load := node.B().FunctionLoad().Replace().FunctionCode(functionLibrary).Build()
+		if err := node.Do(ctx, load).Error(); err != nil {
+			return fmt.Errorf("redis function load on %s failed: %w", addr, classify(err))
+		}
+	}
+	c.functions = true
+	return nil
+}
+
+// redisMajorVersion returns the major version in the INFO server reply info
+func redisMajorVersion(info string) (int, bool) {
+	for _, line := range strings.Split(info, "\n") {
+		version, ok := strings.CutPrefix(strings.TrimSpace(line), "redis_version:")
+		if !ok {
+			continue
+		}
+		major, _, _ := strings.Cut(version, ".")
+		n, err := strconv.Atoi(major)
+		return n, err == nil
+	}
+	return 0, false
+}
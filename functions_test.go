@@ -0,0 +1,69 @@
+package httprateredis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rueian/rueidis"
+	"github.com/rueian/rueidis/mock"
+)
+
+func TestLoadFunctionsSkipsReplicas(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mock.NewClient(ctrl)
+	master := mock.NewClient(ctrl)
+	replica := mock.NewClient(ctrl)
+
+	client.EXPECT().Nodes().Return(map[string]rueidis.Client{"master:6379": master, "replica:6379": replica})
+	master.EXPECT().Do(gomock.Any(), mock.Match("ROLE")).Return(mock.Result(mock.RedisArray(mock.RedisString("master"), mock.RedisInt64(0), mock.RedisArray())))
+	replica.EXPECT().Do(gomock.Any(), mock.Match("ROLE")).Return(mock.Result(mock.RedisArray(mock.RedisString("slave"), mock.RedisString("master"), mock.RedisInt64(6379))))
+	master.EXPECT().Do(gomock.Any(), mock.Match("INFO", "server")).Return(mock.Result(mock.RedisString("# Server\r\nredis_version:7.2.4\r\n")))
+	// the replica would answer READONLY, gomock fails the test if it's sent
+	master.EXPECT().Do(gomock.Any(), mock.Match("FUNCTION", "LOAD", "REPLACE", functionLibrary)).Return(mock.Result(mock.RedisString("httprate")))
+
+	c := NewRedisLimitCounterWithClient(client)
+	if err := c.loadFunctions(context.Background()); err != nil {
+		t.Fatalf("loadFunctions: %v", err)
+	}
+	if !c.functions {
+		t.Error("functions weren't enabled")
+	}
+}
+
+func TestLoadFunctionsOldServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mock.NewClient(ctrl)
+	node := mock.NewClient(ctrl)
+
+	client.EXPECT().Nodes().Return(map[string]rueidis.Client{"node:6379": node})
+	node.EXPECT().Do(gomock.Any(), mock.Match("ROLE")).Return(mock.Result(mock.RedisArray(mock.RedisString("master"), mock.RedisInt64(0), mock.RedisArray())))
+	node.EXPECT().Do(gomock.Any(), mock.Match("INFO", "server")).Return(mock.Result(mock.RedisString("# Server\r\nredis_version:6.2.14\r\n")))
+
+	c := NewRedisLimitCounterWithClient(client)
+	if err := c.loadFunctions(context.Background()); err != nil {
+		t.Fatalf("loadFunctions: %v", err)
+	}
+	if c.functions {
+		t.Error("functions were enabled on Redis 6")
+	}
+}
+
+func TestRedisMajorVersion(t *testing.T) {
+	tests := []struct {
+		info  string
+		major int
+		ok    bool
+	}{
+		{"# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n", 7, true},
+		{"redis_version:6.0.0", 6, true},
+		{"# Server\r\nredis_mode:standalone\r\n", 0, false},
+		{"redis_version:x", 0, false},
+	}
+	for _, tt := range tests {
+		major, ok := redisMajorVersion(tt.info)
+		if major != tt.major || ok != tt.ok {
+			t.Errorf("redisMajorVersion(%q) = %d, %v, want %d, %v", tt.info, major, ok, tt.major, tt.ok)
+		}
+	}
+}
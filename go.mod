@@ -3,8 +3,19 @@ module github.com/Keanu73/httprate-redis
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/alicebob/miniredis/v2 v2.39.0
+	github.com/cespare/xxhash/v2 v2.2.0
 	github.com/go-chi/httprate v0.7.0
+	github.com/golang/mock v1.6.0
+	github.com/redis/go-redis/v9 v9.0.5
 	github.com/rueian/rueidis v0.0.96
+	go.opentelemetry.io/otel v1.14.0
+	go.opentelemetry.io/otel/trace v1.14.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/cespare/xxhash/v2 v2.1.2 // indirect
+require (
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
@@ -0,0 +1,140 @@
+// Package goredis is a go-redis backed httprate.LimitCounter, for
+// applications that already use go-redis and don't want rueidis as a second
+// Redis driver. Counters are keyed and expired like the default
+// httprateredis.RedisLimitCounter, so both can share the same Redis data.
+package goredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-chi/httprate"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	prefixKey        = "httprate:"
+	expiryMultiplier = 3
+	timeout          = 3 * time.Second
+)
+
+// incrementScript increments a window counter, expiring it when it's
+// created, see httprateredis' script of the same name
+var incrementScript = redis.NewScript(`
+local count = redis.call('INCRBY', KEYS[1], ARGV[2])
+if redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// RedisLimitCounter is a go-redis based httprate.LimitCounter.
+type RedisLimitCounter struct {
+	client       redis.UniversalClient
+	ctx          context.Context
+	requestLimit int
+	windowLength time.Duration
+}
+
+var _ httprate.LimitCounter = &RedisLimitCounter{}
+
+// WithRedisLimitCounter returns an httprate option that counts requests
+// with the given go-redis client.
+func WithRedisLimitCounter(client redis.UniversalClient) httprate.Option {
+	return httprate.WithLimitCounter(NewRedisLimitCounter(client))
+}
+
+// NewRedisLimitCounter returns a new LimitCounter backed by the given
+// client. The client is owned by the caller.
+func NewRedisLimitCounter(client redis.UniversalClient) *RedisLimitCounter {
+	return &RedisLimitCounter{
+		client: client,
+		ctx:    context.Background(),
+	}
+}
+
+// SetBaseContext sets the context that Redis calls are made with, so that
+// cancelling it aborts pending Increment and Get calls. It should be called
+// before the counter is in use. Defaults to context.Background().
+func (c *RedisLimitCounter) SetBaseContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// Config modifies the current config of the counter
+func (c *RedisLimitCounter) Config(requestLimit int, windowLength time.Duration) {
+	c.requestLimit = requestLimit
+	c.windowLength = windowLength
+}
+
+func (c *RedisLimitCounter) Increment(key string, currentWindow time.Time) error {
+	// a zero window would expire the key as soon as it's written
+	if c.windowLength <= 0 {
+		return errors.New("redis increment failed: counter is not configured")
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, timeout)
+	defer cancel()
+
+	err := incrementScript.Run(ctx, c.client,
+		[]string{limitCounterKey(key, currentWindow)},
+		c.expiryMillis(currentWindow), 1,
+	).Err()
+	if err != nil {
+		return fmt.Errorf("redis increment failed: %w", err)
+	}
+	return nil
+}
+
+func (c *RedisLimitCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, timeout)
+	defer cancel()
+
+	// separate GETs rather than MGET, as in a cluster the windows of a key
+	// can be stored in different slots
+	pipe := c.client.Pipeline()
+	curr := pipe.Get(ctx, limitCounterKey(key, currentWindow))
+	prev := pipe.Get(ctx, limitCounterKey(key, previousWindow))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, 0, fmt.Errorf("redis get failed: %w", err)
+	}
+
+	currValue, err := windowCount(curr, "current")
+	if err != nil {
+		return 0, 0, err
+	}
+	prevValue, err := windowCount(prev, "previous")
+	if err != nil {
+		return 0, 0, err
+	}
+	return currValue, prevValue, nil
+}
+
+// windowCount parses the GET response of a window counter, treating a
+// missing key as zero
+func windowCount(cmd *redis.StringCmd, window string) (int, error) {
+	v, err := cmd.Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("redis get of %s window failed: %w", window, err)
+	}
+	return v, nil
+}
+
+// expiryMillis returns how many milliseconds from now the current window's
+// key expires, expiryMultiplier window lengths after the window starts
+func (c *RedisLimitCounter) expiryMillis(currentWindow time.Time) int64 {
+	ttl := time.Until(currentWindow.Add(c.windowLength * expiryMultiplier)).Milliseconds()
+	if ttl < 1 {
+		return 1
+	}
+	return ttl
+}
+
+// limitCounterKey returns the key a window counter is stored at
+func limitCounterKey(key string, window time.Time) string {
+	return fmt.Sprintf("%s%d", prefixKey, httprate.LimitCounterKey(key, window))
+}
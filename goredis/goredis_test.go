@@ -0,0 +1,77 @@
+package goredis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	httprateredis "github.com/Keanu73/httprate-redis"
+	"github.com/Keanu73/httprate-redis/goredis"
+)
+
+func TestParityWithRueidisCounter(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	g := goredis.NewRedisLimitCounter(client)
+	g.Config(10, time.Minute)
+
+	r, err := httprateredis.NewRedisLimitCounter(&httprateredis.Config{Addresses: []string{mr.Addr()}})
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounter: %v", err)
+	}
+	defer r.Close()
+	r.Config(10, time.Minute)
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := g.Increment("key", now); err != nil {
+			t.Fatalf("go-redis Increment: %v", err)
+		}
+	}
+	if err := r.Increment("key", now); err != nil {
+		t.Fatalf("rueidis Increment: %v", err)
+	}
+	if err := r.Increment("key", prev); err != nil {
+		t.Fatalf("rueidis Increment: %v", err)
+	}
+
+	// both count into the same keys
+	if keys := mr.Keys(); len(keys) != 2 {
+		t.Errorf("keys = %v, want one per window", keys)
+	}
+	for name, c := range map[string]interface {
+		Get(string, time.Time, time.Time) (int, int, error)
+	}{"go-redis": g, "rueidis": r} {
+		if curr, prevCount, err := c.Get("key", now, prev); err != nil || curr != 3 || prevCount != 1 {
+			t.Errorf("%s Get = %d, %d, %v, want 3, 1, nil", name, curr, prevCount, err)
+		}
+	}
+
+	// and expire new keys alike
+	mr.FlushAll()
+	if err := g.Increment("a", now); err != nil {
+		t.Fatalf("go-redis Increment: %v", err)
+	}
+	if err := r.Increment("b", now); err != nil {
+		t.Fatalf("rueidis Increment: %v", err)
+	}
+	keys := mr.Keys()
+	if len(keys) != 2 {
+		t.Fatalf("keys = %v, want one per counter", keys)
+	}
+	if a, b := mr.TTL(keys[0]), mr.TTL(keys[1]); a-b > time.Second || b-a > time.Second {
+		t.Errorf("TTLs = %v and %v, want them within a second", a, b)
+	}
+}
+
+func TestNotConfigured(t *testing.T) {
+	g := goredis.NewRedisLimitCounter(redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"}))
+	if err := g.Increment("key", time.Now()); err == nil {
+		t.Error("Increment before Config succeeded")
+	}
+}
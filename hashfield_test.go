@@ -0,0 +1,67 @@
+package httprateredis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUseHashFieldWindowLengths(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c, mr := newTestCounter(t, &Config{UseHashField: true, Clock: fixedClock(now)})
+
+	// a minute and an hour window both start at noon
+	if err := c.IncrementWindow("key", now, time.Minute); err != nil {
+		t.Fatalf("IncrementWindow(1m): %v", err)
+	}
+	if err := c.IncrementWindow("key", now, time.Hour); err != nil {
+		t.Fatalf("IncrementWindow(1h): %v", err)
+	}
+
+	minute, _ := c.windowField("key", now, time.Minute)
+	hour, _ := c.windowField("key", now, time.Hour)
+	if minute == hour {
+		t.Fatalf("windows of 1m and 1h share hash %q", minute)
+	}
+	if got, want := mr.TTL(minute), 3*time.Minute; got != want {
+		t.Errorf("TTL of %s = %v, want %v", minute, got, want)
+	}
+	if got, want := mr.TTL(hour), 3*time.Hour; got != want {
+		t.Errorf("TTL of %s = %v, want %v", hour, got, want)
+	}
+
+	curr, _, err := c.GetWindow("key", now, now.Add(-time.Hour), time.Hour)
+	if err != nil {
+		t.Fatalf("GetWindow: %v", err)
+	}
+	if curr != 1 {
+		t.Errorf("GetWindow(1h) current count = %d, want 1", curr)
+	}
+}
+
+func TestUseHashField(t *testing.T) {
+	now := time.Now().UTC()
+	c, mr := newTestCounter(t, &Config{UseHashField: true, Clock: fixedClock(now)})
+	currentWindow := now.Truncate(time.Minute)
+
+	for _, key := range []string{"a", "b", "a"} {
+		if err := c.Increment(key, currentWindow); err != nil {
+			t.Fatalf("Increment(%q): %v", key, err)
+		}
+	}
+	if keys := mr.Keys(); len(keys) != 1 {
+		t.Fatalf("got keys %q, want a single hash", keys)
+	}
+
+	if n, err := c.GetCount("a"); err != nil || n != 2 {
+		t.Errorf("GetCount(a) = %d, %v, want 2", n, err)
+	}
+	if err := c.Reset("a"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if n, err := c.GetCount("a"); err != nil || n != 0 {
+		t.Errorf("GetCount(a) after Reset = %d, %v, want 0", n, err)
+	}
+	if n, err := c.GetCount("b"); err != nil || n != 1 {
+		t.Errorf("GetCount(b) after resetting a = %d, %v, want 1", n, err)
+	}
+}
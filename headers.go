@@ -0,0 +1,103 @@
+package httprateredis
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+// ResponseHeadersMiddleware sets the RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset headers of the IETF RateLimit header fields draft on
+// every response, from the weighted usage counter holds for the request's
+// key. It doesn't count the request, so it's meant to sit alongside a
+// limiter using the same counter, limit and window:
+/*
+	r.Use(httprateredis.ResponseHeadersMiddleware(100, time.Minute, counter, httprate.KeyByIP))
+	r.Use(httprate.Limit(100, time.Minute, httprate.WithKeyByIP(), httprate.WithLimitCounter(counter)))
+*/
+// Keys are composed from keyFuncs like httprate does, every request shares
+// one key if none are given. If the counts can't be read only
+// RateLimit-Limit is set.
+func ResponseHeadersMiddleware(limit int, window time.Duration, counter httprate.LimitCounter, keyFuncs ...httprate.KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit))
+
+			key, err := requestKey(r, keyFuncs)
+			if err == nil {
+				reader, ok := counter.(windowReader)
+				now := time.Now()
+				if ok {
+					now = reader.now()
+				}
+				currentWindow := now.UTC().Truncate(window)
+
+				var curr, prev int
+				if ok {
+					curr, prev, err = reader.readCounts(key, currentWindow, currentWindow.Add(-window))
+				} else {
+					curr, prev, err = counter.Get(key, currentWindow, currentWindow.Add(-window))
+				}
+				if err == nil {
+					remaining := limit - int(math.Round(slidingRate(curr, prev, now.Sub(currentWindow), window)))
+					if remaining < 0 {
+						remaining = 0
+					}
+					reset := int(math.Ceil(currentWindow.Add(window).Sub(now).Seconds()))
+
+					w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+					w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// windowReader is a counter that can read counts without reporting a limit
+// decision, or a ShadowMode request over the limit, and has its own clock
+type windowReader interface {
+	readCounts(key string, currentWindow, previousWindow time.Time) (int, int, error)
+	now() time.Time
+}
+
+func (c *RedisLimitCounter) readCounts(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	return c.countWindow(key, currentWindow, previousWindow, c.windowLength)
+}
+
+func (c *RedisLimitCounter) now() time.Time {
+	return c.clock()
+}
+
+func (r *routeCounter) readCounts(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	if err := r.counter.checkKey(key); err != nil {
+		return 0, 0, err
+	}
+	return r.counter.countWindow(r.key(key), currentWindow, previousWindow, r.windowLength)
+}
+
+func (r *routeCounter) now() time.Time {
+	return r.counter.clock()
+}
+
+// requestKey composes the rate-limit key of r like httprate does
+func requestKey(r *http.Request, keyFuncs []httprate.KeyFunc) (string, error) {
+	if len(keyFuncs) == 0 {
+		return "*", nil
+	}
+
+	var key strings.Builder
+	for _, keyFunc := range keyFuncs {
+		k, err := keyFunc(r)
+		if err != nil {
+			return "", err
+		}
+		key.WriteString(k)
+	}
+	return key.String(), nil
+}
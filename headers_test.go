@@ -0,0 +1,89 @@
+package httprateredis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// shadowHook is a ShadowMetricsHook recording ObserveWouldBlock calls
+type shadowHook struct {
+	mu          sync.Mutex
+	wouldBlocks []int
+	limits      []int
+}
+
+func (h *shadowHook) ObserveIncrement(time.Duration, error) {}
+func (h *shadowHook) ObserveGet(time.Duration, error)       {}
+
+func (h *shadowHook) ObserveWouldBlock(key string, used, limit int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.wouldBlocks = append(h.wouldBlocks, used)
+	h.limits = append(h.limits, limit)
+}
+
+// headers sends a request through ResponseHeadersMiddleware and returns
+// its RateLimit headers
+func headers(t *testing.T, c *RedisLimitCounter, limit int) http.Header {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ResponseHeadersMiddleware(limit, time.Minute, c)(okHandler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Header()
+}
+
+func TestResponseHeadersMiddleware(t *testing.T) {
+	// the counter's clock is half way through the window, real time isn't
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c, _ := newTestCounter(t, &Config{Clock: fixedClock(start.Add(30 * time.Second))})
+
+	for i, want := range []string{"10", "9", "8"} {
+		h := headers(t, c, 10)
+		if got := h.Get("RateLimit-Limit"); got != "10" {
+			t.Errorf("request %d RateLimit-Limit = %q, want 10", i, got)
+		}
+		if got := h.Get("RateLimit-Remaining"); got != want {
+			t.Errorf("request %d RateLimit-Remaining = %q, want %s", i, got, want)
+		}
+		if got := h.Get("RateLimit-Reset"); got != "30" {
+			t.Errorf("request %d RateLimit-Reset = %q, want 30", i, got)
+		}
+		if err := c.Increment("*", start); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+}
+
+func TestResponseHeadersMiddlewareShadowMode(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	hook := &shadowHook{}
+	c, _ := newTestCounter(t, &Config{
+		Clock:      fixedClock(start),
+		ShadowMode: true,
+		Metrics:    hook,
+	})
+	c.Config(2, time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := c.Increment("*", start); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+
+	// the headers show the real usage, without reporting the request as
+	// one ShadowMode would have blocked, which the limiter already does
+	if got := headers(t, c, 2).Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+	if len(hook.wouldBlocks) != 0 {
+		t.Errorf("ObserveWouldBlock was called %d times by the headers", len(hook.wouldBlocks))
+	}
+
+	if _, _, err := c.Get("*", start, start.Add(-time.Minute)); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(hook.wouldBlocks) != 1 {
+		t.Errorf("ObserveWouldBlock was called %d times by Get, want 1", len(hook.wouldBlocks))
+	}
+}
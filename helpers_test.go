@@ -0,0 +1,60 @@
+package httprateredis
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestCounter starts a miniredis server and returns a counter connected
+// to it, configured with a limit of 10 per minute. Both are closed when the
+// test ends.
+func newTestCounter(t *testing.T, cfg *Config) (*RedisLimitCounter, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	cfg.Addresses = []string{mr.Addr()}
+
+	c, err := NewRedisLimitCounter(cfg)
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounter: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	c.Config(10, time.Minute)
+	return c, mr
+}
+
+// fixedClock returns a Clock that always returns now
+func fixedClock(now time.Time) func() time.Time {
+	return func() time.Time { return now }
+}
+
+// testLogger is a Logger recording the messages and args it's given
+type testLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+type logEntry struct {
+	msg  string
+	args []any
+}
+
+func (l *testLogger) Error(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{msg, args})
+}
+
+// logged returns the entries logged so far
+func (l *testLogger) logged() []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]logEntry(nil), l.entries...)
+}
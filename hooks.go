@@ -0,0 +1,27 @@
+package httprateredis
+
+import "time"
+
+// MetricsHook observes the Redis calls made by the counter, e.g. to feed
+// Prometheus counters and histograms.
+type MetricsHook interface {
+	// ObserveIncrement is called after every Redis increment
+	ObserveIncrement(duration time.Duration, err error)
+	// ObserveGet is called after every Redis get
+	ObserveGet(duration time.Duration, err error)
+}
+
+// Logger logs Redis failures, it is satisfied by *slog.Logger.
+type Logger interface {
+	Error(msg string, args ...any)
+}
+
+// reportError hands a failed Redis operation on key to the configured hooks
+func (c *RedisLimitCounter) reportError(msg, key string, err error) {
+	if c.logger != nil {
+		c.logger.Error(msg, "key", key, "error", err)
+	}
+	if c.onError != nil {
+		c.onError(err)
+	}
+}
@@ -0,0 +1,159 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rueian/rueidis"
+	"github.com/rueian/rueidis/mock"
+)
+
+// metricsHook is a MetricsHook recording the errors it's given
+type metricsHook struct {
+	mu         sync.Mutex
+	increments []error
+	gets       []error
+}
+
+func (h *metricsHook) ObserveIncrement(_ time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.increments = append(h.increments, err)
+}
+
+func (h *metricsHook) ObserveGet(_ time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.gets = append(h.gets, err)
+}
+
+var errBroken = errors.New("broken")
+
+// failingClient returns a mock client whose commands all fail with errBroken
+func failingClient(t *testing.T) *mock.Client {
+	t.Helper()
+	client := mock.NewClient(gomock.NewController(t))
+	client.EXPECT().Do(gomock.Any(), gomock.Any()).Return(mock.ErrorResult(errBroken)).AnyTimes()
+	client.EXPECT().DoMulti(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, cmds ...any) []rueidis.RedisResult {
+		results := make([]rueidis.RedisResult, len(cmds))
+		for i := range results {
+			results[i] = mock.ErrorResult(errBroken)
+		}
+		return results
+	}).AnyTimes()
+	return client
+}
+
+func TestMetricsHook(t *testing.T) {
+	hook := &metricsHook{}
+	c, _ := newTestCounter(t, &Config{Metrics: hook})
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	if err := c.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if _, _, err := c.Get("key", now, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(hook.increments) != 1 || hook.increments[0] != nil {
+		t.Errorf("ObserveIncrement got %v, want a single nil error", hook.increments)
+	}
+	if len(hook.gets) != 1 || hook.gets[0] != nil {
+		t.Errorf("ObserveGet got %v, want a single nil error", hook.gets)
+	}
+}
+
+func TestMetricsHookFailure(t *testing.T) {
+	hook := &metricsHook{}
+	c := newRedisLimitCounter(failingClient(t), &Config{Metrics: hook})
+	c.Config(10, time.Minute)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	if err := c.Increment("key", now); !errors.Is(err, errBroken) {
+		t.Fatalf("Increment = %v, want errBroken", err)
+	}
+	if _, _, err := c.Get("key", now, now.Add(-time.Minute)); !errors.Is(err, errBroken) {
+		t.Fatalf("Get = %v, want errBroken", err)
+	}
+	if len(hook.increments) != 1 || !errors.Is(hook.increments[0], errBroken) {
+		t.Errorf("ObserveIncrement got %v, want a single errBroken", hook.increments)
+	}
+	if len(hook.gets) != 1 || !errors.Is(hook.gets[0], errBroken) {
+		t.Errorf("ObserveGet got %v, want a single errBroken", hook.gets)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	logger := &testLogger{}
+	c := newRedisLimitCounter(failingClient(t), &Config{Logger: logger})
+	c.Config(10, time.Minute)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	c.Increment("key", now)
+	c.Get("key", now, now.Add(-time.Minute))
+
+	entries := logger.logged()
+	if len(entries) != 2 {
+		t.Fatalf("logged %d entries, want 2", len(entries))
+	}
+	for i, msg := range []string{"redis increment failed", "redis get failed"} {
+		entry := entries[i]
+		if entry.msg != msg {
+			t.Errorf("entry %d = %q, want %q", i, entry.msg, msg)
+		}
+		if len(entry.args) != 4 || entry.args[0] != "key" || entry.args[1] != "key" || entry.args[2] != "error" {
+			t.Fatalf("entry %d args = %v, want key and error pairs", i, entry.args)
+		}
+		if err, _ := entry.args[3].(error); !errors.Is(err, errBroken) {
+			t.Errorf("entry %d error = %v, want errBroken", i, entry.args[3])
+		}
+	}
+}
+
+func TestLoggerQuietOnSuccess(t *testing.T) {
+	logger := &testLogger{}
+	c, _ := newTestCounter(t, &Config{Logger: logger})
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	c.Increment("key", now)
+	c.Get("key", now, now.Add(-time.Minute))
+
+	if entries := logger.logged(); len(entries) != 0 {
+		t.Errorf("logged %v, want nothing", entries)
+	}
+}
+
+func TestOnErrorCalledOnce(t *testing.T) {
+	var errs []error
+	c := newRedisLimitCounter(failingClient(t), &Config{
+		MaxRetries: 2,
+		OnError:    func(err error) { errs = append(errs, err) },
+	})
+	c.Config(10, time.Minute)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	// errBroken is transient, so the Get is retried before it fails
+	c.Increment("key", now)
+	c.Get("key", now, now.Add(-time.Minute))
+
+	if len(errs) != 2 || !errors.Is(errs[0], errBroken) || !errors.Is(errs[1], errBroken) {
+		t.Errorf("OnError got %v, want errBroken once per call", errs)
+	}
+}
+
+func TestOnErrorQuietOnSuccess(t *testing.T) {
+	called := false
+	c, _ := newTestCounter(t, &Config{OnError: func(error) { called = true }})
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	c.Increment("key", now)
+	c.Get("key", now, now.Add(-time.Minute))
+
+	if called {
+		t.Error("OnError called for calls that succeeded")
+	}
+}
@@ -2,43 +2,390 @@ package httprateredis
 
 import (
 	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/go-chi/httprate"
 	"github.com/rueian/rueidis"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Config defines the config of httprate-redis
 type Config struct {
 	// Addresses is a list of redis host/ports, delimited like so:
 	// * []string{"127.0.0.1:6379"}
-	Addresses []string `toml:"host"`
+	Addresses []string `toml:"addresses" json:"addresses" yaml:"addresses"`
+	// ReadAddresses is a list of redis host/ports that counts are read from,
+	// such as a replica endpoint, while increments go to Addresses. Reads
+	// from replicas may lag slightly behind. Both use Addresses if empty
+	ReadAddresses []string `toml:"read_addresses" json:"read_addresses" yaml:"read_addresses"`
+	// MirrorAddresses is a list of redis host/ports that increments are also
+	// written to, e.g. while migrating to a new cluster. Mirror writes are
+	// made in the background and their failures are only reported
+	MirrorAddresses []string `toml:"mirror_addresses" json:"mirror_addresses" yaml:"mirror_addresses"`
+	// Username is the Redis ACL username (Redis 6+), uses the default user if empty
+	Username string `toml:"username" json:"username" yaml:"username"`
 	// Password is the Redis password (if the cluster has one)
-	Password string `toml:"password"`
+	Password string `toml:"password" json:"password" yaml:"password"`
+	// ClientName is set as the connection name shown by CLIENT LIST
+	ClientName string `toml:"client_name" json:"client_name" yaml:"client_name"` // default "httprate-redis"
 	// DBIndex is the DB index to select
-	DBIndex int `toml:"db_index"` // default 0
+	DBIndex int `toml:"db_index" json:"db_index" yaml:"db_index"` // default 0
+	// LogicalDB isolates counters like a DB index, in any mode: it selects
+	// that DB outside of cluster mode, and adds a "db<N>:" segment to the
+	// prefix in cluster mode, where only db 0 exists. It can't be combined
+	// with DBIndex
+	LogicalDB int `toml:"logical_db" json:"logical_db" yaml:"logical_db"` // default 0
+	// EnableTLS connects over TLS using a default config (TLS 1.2+)
+	// when TLSConfig is not set
+	EnableTLS bool `toml:"enable_tls" json:"enable_tls" yaml:"enable_tls"`
+	// TLSConfig is the TLS config used to connect to Redis
+	TLSConfig *tls.Config `toml:"-" json:"-" yaml:"-"`
+	// DialTimeout bounds connecting to Redis, uses the rueidis default (5s) if zero
+	DialTimeout time.Duration `toml:"dial_timeout" json:"dial_timeout" yaml:"dial_timeout"`
+	// WriteTimeout bounds writes to, and periodic pings of, a Redis
+	// connection, uses the rueidis default (10 times KeepAlive) if zero
+	WriteTimeout time.Duration `toml:"write_timeout" json:"write_timeout" yaml:"write_timeout"`
+	// KeepAlive is the TCP keepalive interval, and how long a connection may
+	// be idle before it is pinged, so that dead connections are found and
+	// replaced before a request needs them. Uses the rueidis default (1s) if zero
+	KeepAlive time.Duration `toml:"keep_alive" json:"keep_alive" yaml:"keep_alive"`
+	// PipelineMultiplex sets the number of pipelined connections to each
+	// Redis node to 2^PipelineMultiplex, uses the rueidis default if zero
+	PipelineMultiplex int `toml:"pipeline_multiplex" json:"pipeline_multiplex" yaml:"pipeline_multiplex"`
+	// BlockingPoolSize is the size of the connection pool for blocking
+	// commands, uses the rueidis default if zero
+	BlockingPoolSize int `toml:"blocking_pool_size" json:"blocking_pool_size" yaml:"blocking_pool_size"`
+	// PrefixKey is prepended to every counter key
+	PrefixKey string `toml:"prefix_key" json:"prefix_key" yaml:"prefix_key"` // default DefaultPrefix
+	// SentinelAddresses is a list of sentinel host/ports, Addresses is used
+	// as the sentinel list if this is empty and SentinelMasterSet is set
+	SentinelAddresses []string `toml:"sentinel_addresses" json:"sentinel_addresses" yaml:"sentinel_addresses"`
+	// SentinelMasterSet is the master set name monitored by sentinel,
+	// enables sentinel mode when set
+	SentinelMasterSet string `toml:"sentinel_master_set" json:"sentinel_master_set" yaml:"sentinel_master_set"`
+	// HashKeys replaces each rate-limit key with a fixed-length SHA-1
+	// digest before the Redis key is composed, bounding key sizes
+	HashKeys bool `toml:"hash_keys" json:"hash_keys" yaml:"hash_keys"`
+	// KeyFormatVersion selects how counter keys are derived. KeyFormatV1
+	// pins the hashing so that upgrading httprate can't change keys and
+	// reset counts; switching versions starts every count from zero
+	KeyFormatVersion int `toml:"key_format_version" json:"key_format_version" yaml:"key_format_version"` // default KeyFormatLegacy
+	// ClusterMode hash-tags counter keys so that every window of a key maps
+	// to the same Redis Cluster slot
+	ClusterMode bool `toml:"cluster_mode" json:"cluster_mode" yaml:"cluster_mode"`
+	// UseHashField stores every counter of a window as a field of one hash
+	// per window, counted with HINCRBY and expired with a single TTL, which
+	// cuts the key count of high-cardinality keyspaces. Each window's hash
+	// lives in a single cluster slot. Only Increment, IncrementBy, Get,
+	// GetCount and Reset use the hash; other methods keep a key per counter.
+	// It can't be combined with KeyFunc
+	UseHashField bool `toml:"use_hash_field" json:"use_hash_field" yaml:"use_hash_field"`
+	// UseFunctions loads the increment scripts as a Redis 7 function
+	// library when the counter is created, and increments with FCALL
+	// rather than EVALSHA. Servers older than Redis 7 keep using EVALSHA
+	UseFunctions bool `toml:"use_functions" json:"use_functions" yaml:"use_functions"`
+	// ExpiryMultiplier expires counter keys this many window lengths after
+	// their window starts, must be at least 2 so the previous window is
+	// still readable
+	ExpiryMultiplier float64 `toml:"expiry_multiplier" json:"expiry_multiplier" yaml:"expiry_multiplier"` // default DefaultExpiryMultiplier
+	// ExpiryJitter adds a random delay of up to this long to each counter
+	// key's expiry, so that keys created in the same window don't all
+	// expire at once
+	ExpiryJitter time.Duration `toml:"expiry_jitter" json:"expiry_jitter" yaml:"expiry_jitter"`
+	// DisableTTL makes Increment and IncrementBy count with a plain INCRBY,
+	// or HINCRBY with UseHashField, and never set an expiry, saving a
+	// command per new key. Keys are then only removed by the server's
+	// maxmemory eviction policy, which the operator must configure, e.g.
+	// volatile-lru won't evict them but allkeys-lru will
+	DisableTTL bool `toml:"disable_ttl" json:"disable_ttl" yaml:"disable_ttl"`
+	// Timeout bounds each Increment and Get call
+	Timeout time.Duration `toml:"timeout" json:"timeout" yaml:"timeout"` // default 3s
+	// CommandTimeout bounds each Redis command sent by Increment and Get,
+	// so that a slow Get fails with ErrCommandTimeout and can be retried
+	// within Timeout. 0 leaves commands bounded by Timeout only
+	CommandTimeout time.Duration `toml:"command_timeout" json:"command_timeout" yaml:"command_timeout"`
+	// ClientSideCache serves Get reads from rueidis' client-side cache,
+	// which requires Redis 6+ with RESP3
+	ClientSideCache bool `toml:"client_side_cache" json:"client_side_cache" yaml:"client_side_cache"`
+	// ClientCacheTTL is how long cached reads are served for, capped at a
+	// tenth of the window so stale counts can't meaningfully exceed limits
+	ClientCacheTTL time.Duration `toml:"client_cache_ttl" json:"client_cache_ttl" yaml:"client_cache_ttl"` // default 100ms
+	// IdempotencyTTL is how long IncrementIdempotent remembers an
+	// idempotency key for
+	IdempotencyTTL time.Duration `toml:"idempotency_ttl" json:"idempotency_ttl" yaml:"idempotency_ttl"` // default 1m
+	// MaxConcurrentOps bounds how many Increment and Get calls are sent to
+	// Redis at once, 0 means no limit
+	MaxConcurrentOps int `toml:"max_concurrent_ops" json:"max_concurrent_ops" yaml:"max_concurrent_ops"`
+	// OverloadMode decides whether calls over MaxConcurrentOps wait or fail
+	OverloadMode OverloadMode `toml:"overload_mode" json:"overload_mode" yaml:"overload_mode"` // default OverloadQueue
+	// CoalesceWindow buffers increments of the same key for this long and
+	// sends them as a single INCRBY, cutting command volume at high request
+	// rates. Increments return before they reach Redis, so counts lag by up
+	// to CoalesceWindow and failures are only reported. 0 disables it
+	CoalesceWindow time.Duration `toml:"coalesce_window" json:"coalesce_window" yaml:"coalesce_window"`
+	// MaxRetries is how many times a failed Increment or Get is retried on
+	// connection errors, within Timeout. Increments are only retried when
+	// they can't have reached Redis, e.g. a failed dial, as one lost on a
+	// reset connection may already have been counted
+	MaxRetries int `toml:"max_retries" json:"max_retries" yaml:"max_retries"` // default 0
+	// RetryBackoff is the delay before the first retry, doubled on each
+	// following one
+	RetryBackoff time.Duration `toml:"retry_backoff" json:"retry_backoff" yaml:"retry_backoff"` // default 50ms
+	// FallbackToLocal counts requests in memory when Redis fails and while
+	// the circuit breaker is open
+	FallbackToLocal bool `toml:"fallback_to_local" json:"fallback_to_local" yaml:"fallback_to_local"`
+	// BreakerThreshold is how many consecutive failures within BreakerWindow
+	// open the circuit breaker, 0 disables it unless FallbackToLocal is set
+	BreakerThreshold int `toml:"breaker_threshold" json:"breaker_threshold" yaml:"breaker_threshold"` // default 1 with FallbackToLocal
+	// BreakerWindow is how close together failures must be to count as
+	// consecutive, 0 counts them regardless of time
+	BreakerWindow time.Duration `toml:"breaker_window" json:"breaker_window" yaml:"breaker_window"`
+	// BreakerCooldown is how long the breaker stays open before probing Redis
+	BreakerCooldown time.Duration `toml:"breaker_cooldown" json:"breaker_cooldown" yaml:"breaker_cooldown"` // default 5s
+	// FailMode decides how calls are answered when Redis fails or the
+	// breaker is open, and FallbackToLocal is not set. Failures are reported
+	// to Logger and OnError either way
+	FailMode FailMode `toml:"fail_mode" json:"fail_mode" yaml:"fail_mode"` // default FailClosed
+	// MaxTrackedKeys reports ErrTooManyKeys to Logger and OnError when Redis
+	// holds more keys than this, checked in the background at most once per
+	// KeyspaceCheckInterval. This is a best-effort safety valve: the count
+	// includes every key in the database, and counting continues as normal.
+	// 0 disables the check
+	MaxTrackedKeys int `toml:"max_tracked_keys" json:"max_tracked_keys" yaml:"max_tracked_keys"`
+	// KeyspaceCheckInterval is how often the MaxTrackedKeys check runs
+	KeyspaceCheckInterval time.Duration `toml:"keyspace_check_interval" json:"keyspace_check_interval" yaml:"keyspace_check_interval"` // default 1m
+	// RejectEmptyKeys makes Increment and Get fail with ErrEmptyKey for an
+	// empty key, rather than counting every such request together
+	RejectEmptyKeys bool `toml:"reject_empty_keys" json:"reject_empty_keys" yaml:"reject_empty_keys"`
+	// RecoverCorruptKeys deletes a counter holding a value that isn't an
+	// integer, such as one written by another application at a colliding
+	// key, and counts it as zero rather than failing. Deletions are reported
+	// to Logger and OnError
+	RecoverCorruptKeys bool `toml:"recover_corrupt_keys" json:"recover_corrupt_keys" yaml:"recover_corrupt_keys"`
+	// StrictExisting makes Get fail with ErrKeyNotFound when neither window
+	// of a key exists, e.g. to detect that it was never incremented, rather
+	// than returning zero counts. httprate's middleware fails requests Get
+	// returns an error for, so this is meant for calling Get directly
+	StrictExisting bool `toml:"strict_existing" json:"strict_existing" yaml:"strict_existing"`
+	// ShadowMode counts requests as usual but never limits them, so that a
+	// new limit can be measured before it's enforced. Requests over the
+	// limit are reported to Metrics if it is a ShadowMetricsHook
+	ShadowMode bool `toml:"shadow_mode" json:"shadow_mode" yaml:"shadow_mode"`
+	// Metrics observes every Redis increment and get
+	Metrics MetricsHook `toml:"-" json:"-" yaml:"-"`
+	// Tracer creates a span around every Redis increment and get
+	Tracer trace.Tracer `toml:"-" json:"-" yaml:"-"`
+	// Logger logs failed Redis increments and gets
+	Logger Logger `toml:"-" json:"-" yaml:"-"`
+	// OnError is called with every failed Redis increment and get error
+	OnError func(err error) `toml:"-" json:"-" yaml:"-"`
+	// Clock returns the current time, defaults to time.Now
+	Clock func() time.Time `toml:"-" json:"-" yaml:"-"`
+	// KeyFunc builds the Redis key of a rate-limit key's window, replacing
+	// PrefixKey and the default key format. It must return the same key for
+	// the same arguments and different keys for different ones. In cluster
+	// mode, both windows of a key must hash to the same slot.
+	KeyFunc func(baseKey string, window time.Time) string `toml:"-" json:"-" yaml:"-"`
 }
 
-type redisCounter struct {
-	Client       rueidis.Client
+// ErrKeyNotFound is returned when a key is required to exist but doesn't.
+// Get and GetCount report missing window keys as a zero count instead,
+// unless Get is made to require them with StrictExisting.
+var ErrKeyNotFound = errors.New("redis key not found")
+
+// ErrEmptyKey is returned by Increment and Get for an empty key when
+// RejectEmptyKeys is set.
+var ErrEmptyKey = errors.New("rate-limit key is empty")
+
+// ErrNoExpiry is returned by KeyTTL when a key exists without an expiry.
+var ErrNoExpiry = errors.New("redis key has no expiry")
+
+// Validate checks the config for invalid or conflicting values.
+func (cfg *Config) Validate() error {
+	for i, addr := range cfg.Addresses {
+		if err := validateAddress(addr); err != nil {
+			return fmt.Errorf("invalid config: address %d %w", i, err)
+		}
+	}
+	for i, addr := range cfg.ReadAddresses {
+		if err := validateAddress(addr); err != nil {
+			return fmt.Errorf("invalid config: read address %d %w", i, err)
+		}
+	}
+	for i, addr := range cfg.MirrorAddresses {
+		if err := validateAddress(addr); err != nil {
+			return fmt.Errorf("invalid config: mirror address %d %w", i, err)
+		}
+	}
+	for i, addr := range cfg.SentinelAddresses {
+		if err := validateAddress(addr); err != nil {
+			return fmt.Errorf("invalid config: sentinel address %d %w", i, err)
+		}
+	}
+	if cfg.DBIndex < 0 {
+		return fmt.Errorf("invalid config: db index must not be negative, got %d", cfg.DBIndex)
+	}
+	if cfg.LogicalDB < 0 {
+		return fmt.Errorf("invalid config: logical db must not be negative, got %d", cfg.LogicalDB)
+	}
+	if cfg.LogicalDB != 0 && cfg.DBIndex != 0 {
+		return errors.New("invalid config: logical db and db index can't both be set")
+	}
+	if cfg.DBIndex != 0 && cfg.ClusterMode {
+		return fmt.Errorf("invalid config: redis cluster only supports db 0, got db index %d", cfg.DBIndex)
+	}
+	if cfg.SentinelMasterSet != "" && cfg.ClusterMode {
+		return errors.New("invalid config: sentinel and cluster mode can't both be set")
+	}
+	if cfg.SentinelMasterSet != "" && (len(cfg.ReadAddresses) > 0 || len(cfg.MirrorAddresses) > 0) {
+		return errors.New("invalid config: sentinel and read or mirror addresses can't both be set")
+	}
+	if cfg.UseHashField && cfg.KeyFunc != nil {
+		return errors.New("invalid config: use hash field and key func can't both be set")
+	}
+	if cfg.ExpiryMultiplier != 0 && cfg.ExpiryMultiplier < 2 {
+		return fmt.Errorf("invalid config: expiry multiplier must be at least 2, got %v", cfg.ExpiryMultiplier)
+	}
+	if cfg.KeyFormatVersion != KeyFormatLegacy && cfg.KeyFormatVersion != KeyFormatV1 {
+		return fmt.Errorf("invalid config: unknown key format version %d", cfg.KeyFormatVersion)
+	}
+	if cfg.ExpiryJitter < 0 {
+		return fmt.Errorf("invalid config: expiry jitter must not be negative, got %v", cfg.ExpiryJitter)
+	}
+	if cfg.MaxTrackedKeys < 0 {
+		return fmt.Errorf("invalid config: max tracked keys must not be negative, got %d", cfg.MaxTrackedKeys)
+	}
+	if cfg.IdempotencyTTL < 0 {
+		return fmt.Errorf("invalid config: idempotency ttl must not be negative, got %v", cfg.IdempotencyTTL)
+	}
+	if cfg.MaxConcurrentOps < 0 {
+		return fmt.Errorf("invalid config: max concurrent ops must not be negative, got %d", cfg.MaxConcurrentOps)
+	}
+	if cfg.CommandTimeout < 0 {
+		return fmt.Errorf("invalid config: command timeout must not be negative, got %v", cfg.CommandTimeout)
+	}
+	if cfg.CoalesceWindow < 0 {
+		return fmt.Errorf("invalid config: coalesce window must not be negative, got %v", cfg.CoalesceWindow)
+	}
+	if cfg.MaxRetries < 0 {
+		return fmt.Errorf("invalid config: max retries must not be negative, got %d", cfg.MaxRetries)
+	}
+	return nil
+}
+
+// validateAddress checks that addr is a host:port pair rueidis can dial,
+// IPv6 hosts must be bracketed, like [::1]:6379
+func validateAddress(addr string) error {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return errors.New("is empty")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("must be host:port, with IPv6 hosts in brackets: %w", err)
+	}
+	return nil
+}
+
+// Defaults used for the corresponding unset Config fields.
+const (
+	// DefaultAddress is the Redis address connected to when Addresses is empty
+	DefaultAddress = "127.0.0.1:6379"
+	// DefaultPrefix is prepended to counter keys when PrefixKey is empty
+	DefaultPrefix = "httprate:"
+	// DefaultExpiryMultiplier is used when ExpiryMultiplier is zero
+	DefaultExpiryMultiplier = 3
+)
+
+const (
+	defaultTimeout         = 3 * time.Second
+	defaultClientCacheTTL  = 100 * time.Millisecond
+	defaultRetryBackoff    = 50 * time.Millisecond
+	defaultBreakerCooldown = 5 * time.Second
+	defaultIdempotencyTTL  = time.Minute
+)
+
+// RedisLimitCounter is a redis-based httprate.LimitCounter.
+type RedisLimitCounter struct {
+	client       rueidis.Client
+	reader       rueidis.Client
+	mirror       rueidis.Client
+	ctx          context.Context
+	clock        func() time.Time
+	prefix       string
+	cluster      bool
+	hashKeys     bool
+	keyVersion   int
+	hashField    bool
+	functions    bool
+	expiry       float64
+	jitter       time.Duration
+	randInt63n   func(n int64) int64
+	noTTL        bool
+	timeout      time.Duration
+	cmdTimeout   time.Duration
+	cacheTTL     time.Duration
+	idemTTL      time.Duration
+	maxRetries   int
+	retryBackoff time.Duration
+	requestLimit int
 	windowLength time.Duration
+	ownsClient   bool
+	closeOnce    sync.Once
+	drain        *drain
+	metrics      MetricsHook
+	tracer       trace.Tracer
+	logger       Logger
+	onError      func(err error)
+	keyFunc      func(baseKey string, window time.Time) string
+	stats        stats
+	reqContexts  *requestContexts
+
+	fallbackToLocal bool
+	fallback        httprate.LimitCounter
+	fallbackWindow  time.Duration
+	breaker         *breaker
+	failMode        FailMode
+	shadow          bool
+	rejectEmptyKeys bool
+	recoverCorrupt  bool
+	strictExisting  bool
+	keyspace        *keyspaceGuard
+	sem             chan struct{}
+	coalescer       *coalescer
+	overloadMode    OverloadMode
 }
 
+var _ httprate.LimitCounter = &RedisLimitCounter{}
+
 // WithRedisLimitCounter is middleware that can be fed to httprate.
 // Example:
 /*
+	redisCounter, err := httprateredis.WithRedisLimitCounter(
+		&httprateredis.Config{
+			Addresses: redisAddresses,
+			Password:  redisPassword,
+		},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	limiter := httprate.Limit(
 		serverOptions.RequestLimit,
 		serverOptions.RequestPeriod,
 		httprate.WithKeyByRealIP(),
-		httprateredis.WithRedisLimitCounter(
-			&httprateredis.Config{
-				Addresses: redisAddresses,
-				Password:  redisPassword,
-			},
-		),
+		redisCounter,
 	)
 */
 func WithRedisLimitCounter(cfg *Config) (httprate.Option, error) {
@@ -49,91 +396,1153 @@ func WithRedisLimitCounter(cfg *Config) (httprate.Option, error) {
 	return httprate.WithLimitCounter(rc), nil
 }
 
+// WithRedisLimitCounterClient is like WithRedisLimitCounter, but uses an
+// existing rueidis client instead of opening a new connection.
+func WithRedisLimitCounterClient(client rueidis.Client) httprate.Option {
+	return httprate.WithLimitCounter(NewRedisLimitCounterWithClient(client))
+}
+
 // NewRedisLimitCounter returns a new redis-based LimitCounter.
-func NewRedisLimitCounter(cfg *Config) (httprate.LimitCounter, error) {
+// Call Close to release the underlying Redis connections.
+func NewRedisLimitCounter(cfg *Config) (*RedisLimitCounter, error) {
 	if cfg == nil {
 		cfg = &Config{}
 	}
-	if len(cfg.Addresses) == 0 {
-		cfg.Addresses[0] = "127.0.0.1:6379"
+	opts, err := buildClientOption(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := rueidis.NewClient(opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to redis: %w", err)
+	}
+
+	rc := newRedisLimitCounter(client, cfg)
+	rc.ownsClient = true
+
+	if readAddresses := normalizeAddresses(cfg.ReadAddresses); len(readAddresses) > 0 {
+		rc.reader, err = newSecondaryClient(opts, readAddresses)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("unable to connect to redis read addresses: %w", err)
+		}
+	}
+
+	if mirrorAddresses := normalizeAddresses(cfg.MirrorAddresses); len(mirrorAddresses) > 0 {
+		rc.mirror, err = newSecondaryClient(opts, mirrorAddresses)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("unable to connect to redis mirror addresses: %w", err)
+		}
+	}
+
+	if cfg.UseFunctions {
+		ctx, cancel := rc.opContext(rc.ctx)
+		defer cancel()
+		if err := rc.loadFunctions(ctx); err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("unable to load redis functions: %w", err)
+		}
+	}
+
+	return rc, nil
+}
+
+// newSecondaryClient connects to addresses with the primary client's options
+func newSecondaryClient(opts rueidis.ClientOption, addresses []string) (rueidis.Client, error) {
+	opts.InitAddress = addresses
+	opts.ShuffleInit = len(addresses) > 1
+	return rueidis.NewClient(opts)
+}
+
+// buildClientOption validates cfg and builds the rueidis options it
+// describes, with addresses trimmed and deduplicated
+func buildClientOption(cfg *Config) (rueidis.ClientOption, error) {
+	if err := cfg.Validate(); err != nil {
+		return rueidis.ClientOption{}, err
+	}
+
+	addresses := normalizeAddresses(cfg.Addresses)
+	if len(addresses) == 0 {
+		addresses = []string{DefaultAddress}
+	}
+
+	clientName := cfg.ClientName
+	if clientName == "" {
+		clientName = "httprate-redis"
 	}
 
 	opts := rueidis.ClientOption{
-		InitAddress: cfg.Addresses,
+		InitAddress: addresses,
+		ClientName:  clientName,
 		SelectDB:    0,
 	}
 
+	if cfg.Username != "" {
+		opts.Username = cfg.Username
+	}
+
 	if cfg.Password != "" {
 		opts.Password = cfg.Password
 	}
 
-	if len(cfg.Addresses) > 1 {
+	if cfg.DBIndex != 0 {
+		opts.SelectDB = cfg.DBIndex
+	}
+
+	if cfg.LogicalDB != 0 && !cfg.ClusterMode {
+		opts.SelectDB = cfg.LogicalDB
+	}
+
+	if cfg.DialTimeout != 0 {
+		opts.Dialer.Timeout = cfg.DialTimeout
+	}
+
+	if cfg.KeepAlive != 0 {
+		opts.Dialer.KeepAlive = cfg.KeepAlive
+	}
+
+	if cfg.WriteTimeout != 0 {
+		opts.ConnWriteTimeout = cfg.WriteTimeout
+	}
+
+	if cfg.PipelineMultiplex != 0 {
+		opts.PipelineMultiplex = cfg.PipelineMultiplex
+	}
+
+	if cfg.BlockingPoolSize != 0 {
+		opts.BlockingPoolSize = cfg.BlockingPoolSize
+	}
+
+	if cfg.SentinelMasterSet != "" {
+		opts.Sentinel.MasterSet = cfg.SentinelMasterSet
+		if sentinels := normalizeAddresses(cfg.SentinelAddresses); len(sentinels) > 0 {
+			opts.InitAddress = sentinels
+		}
+	}
+
+	if !cfg.ClientSideCache {
+		opts.DisableCache = true
+	}
+
+	if len(opts.InitAddress) > 1 {
 		opts.ShuffleInit = true
 	}
 
-	if cfg.DBIndex != 0 {
-		opts.SelectDB = cfg.DBIndex
+	if cfg.TLSConfig != nil {
+		opts.TLSConfig = cfg.TLSConfig
+	} else if cfg.EnableTLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
 	}
 
-	client, err := rueidis.NewClient(opts)
-	if err != nil {
-		return nil, fmt.Errorf("unable to c.Client.ct to redis: %w", err)
+	return opts, nil
+}
+
+// normalizeAddresses returns addresses with surrounding whitespace trimmed
+// and duplicates removed, in their original order
+func normalizeAddresses(addresses []string) []string {
+	seen := make(map[string]bool, len(addresses))
+	normalized := make([]string, 0, len(addresses))
+	for _, addr := range addresses {
+		addr = strings.TrimSpace(addr)
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		normalized = append(normalized, addr)
+	}
+	return normalized
+}
+
+// NewRedisLimitCounterContext is like NewRedisLimitCounter, but returns an
+// error if the connection can't be established and pinged before ctx is done.
+func NewRedisLimitCounterContext(ctx context.Context, cfg *Config) (*RedisLimitCounter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("unable to connect to redis: %w", err)
+	}
+
+	type result struct {
+		rc  *RedisLimitCounter
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rc, err := NewRedisLimitCounter(cfg)
+		done <- result{rc, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		// release the client once the abandoned connection attempt returns
+		go func() {
+			if r := <-done; r.err == nil {
+				r.rc.Close()
+			}
+		}()
+		return nil, fmt.Errorf("unable to connect to redis: %w", ctx.Err())
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		if err := r.rc.Ping(ctx); err != nil {
+			r.rc.Close()
+			return nil, fmt.Errorf("unable to connect to redis: %w", err)
+		}
+		return r.rc, nil
+	}
+}
+
+// NewRedisLimitCounterWithClient returns a new redis-based LimitCounter
+// backed by the given client. The client is owned by the caller and is not
+// closed by Close.
+func NewRedisLimitCounterWithClient(client rueidis.Client) *RedisLimitCounter {
+	return newRedisLimitCounter(client, &Config{})
+}
+
+// setDefaults fills in the defaults of unset fields
+func (cfg *Config) setDefaults() {
+	if cfg.PrefixKey == "" {
+		cfg.PrefixKey = DefaultPrefix
+	}
+	if cfg.ExpiryMultiplier == 0 {
+		cfg.ExpiryMultiplier = DefaultExpiryMultiplier
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	// a TTL alone doesn't turn the cache on
+	if !cfg.ClientSideCache {
+		cfg.ClientCacheTTL = 0
+	} else if cfg.ClientCacheTTL == 0 {
+		cfg.ClientCacheTTL = defaultClientCacheTTL
+	}
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+	if cfg.IdempotencyTTL == 0 {
+		cfg.IdempotencyTTL = defaultIdempotencyTTL
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = time.Now
+	}
+	if cfg.FallbackToLocal && cfg.BreakerThreshold == 0 {
+		cfg.BreakerThreshold = 1
+	}
+	if cfg.BreakerCooldown == 0 {
+		cfg.BreakerCooldown = defaultBreakerCooldown
+	}
+	if cfg.MaxTrackedKeys > 0 && cfg.KeyspaceCheckInterval == 0 {
+		cfg.KeyspaceCheckInterval = defaultKeyspaceCheckInterval
+	}
+}
+
+// newRedisLimitCounter applies the config defaults to a copy of cfg, leaving
+// the caller's config as it was, and builds the counter
+func newRedisLimitCounter(client rueidis.Client, cfg *Config) *RedisLimitCounter {
+	defaulted := *cfg
+	cfg = &defaulted
+	cfg.setDefaults()
+
+	rc := &RedisLimitCounter{
+		client:          client,
+		reader:          client,
+		ctx:             context.Background(),
+		clock:           cfg.Clock,
+		prefix:          logicalPrefix(cfg),
+		cluster:         cfg.ClusterMode,
+		hashKeys:        cfg.HashKeys,
+		keyVersion:      cfg.KeyFormatVersion,
+		hashField:       cfg.UseHashField,
+		expiry:          cfg.ExpiryMultiplier,
+		jitter:          cfg.ExpiryJitter,
+		randInt63n:      rand.Int63n,
+		noTTL:           cfg.DisableTTL,
+		timeout:         cfg.Timeout,
+		cmdTimeout:      cfg.CommandTimeout,
+		cacheTTL:        cfg.ClientCacheTTL,
+		idemTTL:         cfg.IdempotencyTTL,
+		maxRetries:      cfg.MaxRetries,
+		retryBackoff:    cfg.RetryBackoff,
+		fallbackToLocal: cfg.FallbackToLocal,
+		failMode:        cfg.FailMode,
+		shadow:          cfg.ShadowMode,
+		rejectEmptyKeys: cfg.RejectEmptyKeys,
+		recoverCorrupt:  cfg.RecoverCorruptKeys,
+		strictExisting:  cfg.StrictExisting,
+		metrics:         cfg.Metrics,
+		tracer:          cfg.Tracer,
+		logger:          cfg.Logger,
+		onError:         cfg.OnError,
+		keyFunc:         cfg.KeyFunc,
+		overloadMode:    cfg.OverloadMode,
+		reqContexts:     &requestContexts{},
+		drain:           &drain{},
+	}
+	if cfg.CoalesceWindow > 0 {
+		rc.coalescer = &coalescer{
+			window:  cfg.CoalesceWindow,
+			pending: make(map[coalesceKey]*coalesced),
+		}
+	}
+	if cfg.MaxConcurrentOps > 0 {
+		rc.sem = make(chan struct{}, cfg.MaxConcurrentOps)
+	}
+	if cfg.BreakerThreshold > 0 {
+		rc.breaker = &breaker{
+			threshold: cfg.BreakerThreshold,
+			window:    cfg.BreakerWindow,
+			cooldown:  cfg.BreakerCooldown,
+		}
+	}
+	if cfg.MaxTrackedKeys > 0 {
+		rc.keyspace = &keyspaceGuard{
+			max:      int64(cfg.MaxTrackedKeys),
+			interval: cfg.KeyspaceCheckInterval,
+		}
+	}
+	return rc
+}
+
+// logicalPrefix returns the key prefix of cfg, including its LogicalDB in
+// cluster mode
+func logicalPrefix(cfg *Config) string {
+	if cfg.LogicalDB != 0 && cfg.ClusterMode {
+		return fmt.Sprintf("%sdb%d:", cfg.PrefixKey, cfg.LogicalDB)
+	}
+	return cfg.PrefixKey
+}
+
+// Close releases the underlying Redis client. It is safe to call more than
+// once; any Increment or Get after Close returns an error. Clients passed to
+// NewRedisLimitCounterWithClient are left open.
+func (c *RedisLimitCounter) Close() error {
+	if !c.ownsClient {
+		return nil
+	}
+	c.closeOnce.Do(func() {
+		// rueidis closes connections in the background, so calls made
+		// straight after Close could still get through
+		c.drain.stop()
+		c.client.Close()
+		if c.reader != c.client {
+			c.reader.Close()
+		}
+		if c.mirror != nil {
+			c.mirror.Close()
+		}
+	})
+	return nil
+}
+
+// Client returns the underlying rueidis client, for running other commands
+// on the same connection. Clients created by NewRedisLimitCounter are owned
+// by the counter and must be released with Close, not closed directly.
+func (c *RedisLimitCounter) Client() rueidis.Client {
+	return c.client
+}
+
+// Ping checks that Redis is reachable.
+func (c *RedisLimitCounter) Ping(ctx context.Context) error {
+	if !c.drain.begin() {
+		return fmt.Errorf("redis ping failed: %w", ErrShuttingDown)
 	}
+	defer c.drain.end()
 
-	return &redisCounter{
-		Client: client,
-	}, nil
+	if err := c.client.Do(ctx, c.client.B().Ping().Build()).Error(); err != nil {
+		return fmt.Errorf("redis ping failed: %w", classify(err))
+	}
+	return nil
+}
+
+// SetBaseContext sets the context that Redis calls are made with, so that
+// cancelling it aborts pending Increment and Get calls. It should be called
+// before the counter is in use. Defaults to context.Background().
+func (c *RedisLimitCounter) SetBaseContext(ctx context.Context) {
+	c.ctx = ctx
 }
 
 // Config modifies the current config of the counter
-func (c *redisCounter) Config(requestLimit int, windowLength time.Duration) {
+func (c *RedisLimitCounter) Config(requestLimit int, windowLength time.Duration) {
+	c.requestLimit = requestLimit
 	c.windowLength = windowLength
+	c.configureFallback(requestLimit, windowLength)
+}
+
+// configureFallback creates the in-memory fallback counter with
+// FallbackToLocal. Route namespaces share it, so it keeps counts for the
+// longest window it's configured with.
+func (c *RedisLimitCounter) configureFallback(requestLimit int, windowLength time.Duration) {
+	if !c.fallbackToLocal {
+		return
+	}
+	if c.fallback == nil {
+		c.fallback = httprate.NewRateLimiter(requestLimit, windowLength).Counter()
+		c.fallbackWindow = windowLength
+	} else if windowLength > c.fallbackWindow {
+		c.fallback.Config(requestLimit, windowLength)
+		c.fallbackWindow = windowLength
+	}
 }
 
-func (c *redisCounter) Increment(key string, currentWindow time.Time) error {
-	hkey := limitCounterKey(key, currentWindow)
+// RequestLimit returns the request limit the counter was configured with
+func (c *RedisLimitCounter) RequestLimit() int {
+	return c.requestLimit
+}
 
-	incrQuery := c.Client.B().Incr().Key(hkey).Build()
-	expireQuery := c.Client.B().Expire().Key(hkey).Seconds(int64(c.windowLength.Seconds() * 3)).Build()
+// WindowLength returns the window length the counter was configured with
+func (c *RedisLimitCounter) WindowLength() time.Duration {
+	return c.windowLength
+}
+
+func (c *RedisLimitCounter) Increment(key string, currentWindow time.Time) error {
+	return c.incrementWindow(key, currentWindow, c.windowLength, 1)
+}
+
+// IncrementWindow increments the current window count of key, expiring it
+// relative to window rather than the configured window length, so that one
+// counter can back limiters of several windows, such as per-tier limits.
+// Each window length has its own counter, unless it's the configured one,
+// which Increment counts in too. Read the counts back with GetWindow and
+// the same window.
+func (c *RedisLimitCounter) IncrementWindow(key string, currentWindow time.Time, window time.Duration) error {
+	return c.incrementWindow(key, currentWindow, window, 1)
+}
+
+// IncrementBy increments the current window count of key by n, for requests
+// that cost more than one unit of quota. n must be positive.
+func (c *RedisLimitCounter) IncrementBy(key string, currentWindow time.Time, n int64) error {
+	if n <= 0 {
+		return fmt.Errorf("redis increment failed: n must be positive, got %d", n)
+	}
+	return c.incrementWindow(key, currentWindow, c.windowLength, n)
+}
+
+// incrementWindow increments key by n, expiring it relative to windowLength
+func (c *RedisLimitCounter) incrementWindow(key string, currentWindow time.Time, windowLength time.Duration, n int64) error {
+	// a zero window would expire the key as soon as it's written
+	if windowLength <= 0 {
+		return errors.New("redis increment failed: counter is not configured")
+	}
+	ctx, key := c.requestContext(key)
+	if err := c.checkKey(key); err != nil {
+		return err
+	}
+	if c.coalescer != nil {
+		return c.coalesce(key, currentWindow, windowLength, n)
+	}
 
-	result := c.Client.DoMulti(context.Background(), incrQuery, expireQuery)
-	for _, response := range result {
-		if response.Error() != nil {
-			return fmt.Errorf("redis increment failed: %w", response.Error())
+	if !c.drain.begin() {
+		return ErrShuttingDown
+	}
+	defer c.drain.end()
+	return c.incrementNow(ctx, key, currentWindow, windowLength, n)
+}
+
+// incrementNow increments key by n in Redis, through the breaker and fallback
+func (c *RedisLimitCounter) incrementNow(ctx context.Context, key string, currentWindow time.Time, windowLength time.Duration, n int64) error {
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	// a slot is taken before the breaker is asked, so that a half-open
+	// probe it lets through always reaches Redis and records its outcome
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	defer c.release()
+
+	if !c.breaker.allow(c.clock()) {
+		if c.fallback != nil {
+			return c.fallbackIncrement(key, currentWindow, n)
+		}
+		if c.failMode == FailOpen {
+			return nil
+		}
+		return ErrCircuitOpen
+	}
+
+	command := c.incrementCommand()
+	ctx, span := c.startSpan(ctx, "Increment", command, currentWindow)
+	start := time.Now()
+	err := c.retryWrite(ctx, func() error {
+		return c.increment(ctx, command, key, currentWindow, windowLength, n)
+	})
+	c.breaker.record(c.clock(), err)
+	c.stats.record(&c.stats.increments, &c.stats.incrementFailures, err)
+	endSpan(span, err)
+	if c.metrics != nil {
+		c.metrics.ObserveIncrement(time.Since(start), err)
+	}
+	if err != nil {
+		c.reportError("redis increment failed", key, err)
+		if c.fallback != nil {
+			return c.fallbackIncrement(key, currentWindow, n)
 		}
+		if c.failMode == FailOpen {
+			return nil
+		}
+		return err
 	}
 
+	c.mirrorIncrement(key, currentWindow, windowLength, n)
+	c.checkKeyspace()
 	return nil
 }
 
-func (c *redisCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
-	getCurrValue := c.Client.B().Get().Key(limitCounterKey(key, currentWindow)).Build()
-	getPrevValue := c.Client.B().Get().Key(limitCounterKey(key, previousWindow)).Build()
+// mirrorIncrement increments key on the mirror in the background, reporting
+// but otherwise ignoring failures
+func (c *RedisLimitCounter) mirrorIncrement(key string, currentWindow time.Time, windowLength time.Duration, n int64) {
+	if c.mirror == nil || !c.drain.begin() {
+		return
+	}
 
-	result := c.Client.DoMulti(context.Background(), getCurrValue, getPrevValue)
-	for _, response := range result {
-		if response.Error() != nil {
-			if response.Error() == rueidis.Nil {
-				return 0, 0, errors.New("redis get failed: nil")
-			}
-			return 0, 0, fmt.Errorf("redis get failed: %w", response.Error())
+	go func() {
+		defer c.drain.end()
+
+		ctx, cancel := c.opContext(c.ctx)
+		defer cancel()
+
+		if err := c.runIncrement(ctx, c.mirror, false, key, currentWindow, windowLength, n); err != nil {
+			c.reportError("redis mirror increment failed", key, classify(err))
 		}
+	}()
+}
+
+// Get returns the current and previous window counts of key. A window that
+// doesn't exist, or has expired, counts as zero, so a new key returns 0, 0
+// and no error; with StrictExisting it returns ErrKeyNotFound instead if
+// neither window exists.
+func (c *RedisLimitCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	return c.getWindow(key, currentWindow, previousWindow, c.requestLimit, c.windowLength)
+}
+
+// GetWindow returns the window counts of key counted with IncrementWindow
+// and the same window. Not knowing the caller's limit, it returns the
+// stored counts even in ShadowMode, and reports no decision to Metrics.
+func (c *RedisLimitCounter) GetWindow(key string, currentWindow, previousWindow time.Time, window time.Duration) (int, int, error) {
+	if window <= 0 {
+		return 0, 0, fmt.Errorf("redis get failed: window must be positive, got %v", window)
 	}
 
-	curr, err := result[0].ToInt64()
+	ctx, key := c.requestContext(key)
+	if err := c.checkKey(key); err != nil {
+		return 0, 0, err
+	}
+	return c.getCounts(ctx, key, currentWindow, previousWindow, window)
+}
+
+// getCounts gets the window counts of key, through the breaker and fallback
+func (c *RedisLimitCounter) getCounts(ctx context.Context, key string, currentWindow, previousWindow time.Time, windowLength time.Duration) (int, int, error) {
+	if !c.drain.begin() {
+		return 0, 0, ErrShuttingDown
+	}
+	defer c.drain.end()
+
+	ctx, cancel := c.opContext(ctx)
+	defer cancel()
+
+	// acquired before the breaker is asked, as in incrementNow
+	if err := c.acquire(ctx); err != nil {
+		return 0, 0, err
+	}
+	defer c.release()
+
+	if !c.breaker.allow(c.clock()) {
+		if c.fallback != nil {
+			return c.fallback.Get(key, currentWindow, previousWindow)
+		}
+		if c.failMode == FailOpen {
+			return 0, 0, nil
+		}
+		return 0, 0, ErrCircuitOpen
+	}
+
+	ctx, span := c.startSpan(ctx, "Get", "GET", currentWindow)
+	start := time.Now()
+	var curr, prev int
+	err := c.retry(ctx, func() (err error) {
+		curr, prev, err = c.get(ctx, key, currentWindow, previousWindow, windowLength)
+		return err
+	})
+	// a missing key is an answer from Redis rather than a failure
+	notFound := errors.Is(err, ErrKeyNotFound)
+	if notFound {
+		err = nil
+	}
+	c.breaker.record(c.clock(), err)
+	c.stats.record(&c.stats.gets, &c.stats.getFailures, err)
+	endSpan(span, err)
+	if c.metrics != nil {
+		c.metrics.ObserveGet(time.Since(start), err)
+	}
+	if err != nil {
+		c.reportError("redis get failed", key, err)
+		if c.fallback != nil {
+			return c.fallback.Get(key, currentWindow, previousWindow)
+		}
+		if c.failMode == FailOpen {
+			return 0, 0, nil
+		}
+	}
+	if notFound {
+		return 0, 0, ErrKeyNotFound
+	}
+	return curr, prev, err
+}
+
+// fallbackIncrement increments key by n on the in-memory counter
+func (c *RedisLimitCounter) fallbackIncrement(key string, currentWindow time.Time, n int64) error {
+	for i := int64(0); i < n; i++ {
+		if err := c.fallback.Increment(key, currentWindow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// incrementCommand returns the command increments are sent with, for spans
+// and per-command metrics
+func (c *RedisLimitCounter) incrementCommand() string {
+	switch {
+	case c.noTTL:
+		return "INCRBY"
+	case c.functions:
+		return "FCALL"
+	}
+	return "EVALSHA"
+}
+
+func (c *RedisLimitCounter) increment(ctx context.Context, command, key string, currentWindow time.Time, windowLength time.Duration, n int64) error {
+	cmdCtx, cancel := c.commandContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	err := c.runIncrement(cmdCtx, c.client, c.functions, key, currentWindow, windowLength, n)
+	if err := c.observeCommand(ctx, cmdCtx, command, start, err); err != nil {
+		return fmt.Errorf("redis increment failed: %w", classify(err))
+	}
+
+	return nil
+}
+
+// runIncrement increments the counter of key by n on client, with FCALL
+// when fcall is set. Nodes that lost the library, e.g. after a restart
+// without persistence, are incremented with EVALSHA instead. With
+// DisableTTL it's a plain INCRBY or HINCRBY.
+func (c *RedisLimitCounter) runIncrement(ctx context.Context, client rueidis.Client, fcall bool, key string, currentWindow time.Time, windowLength time.Duration, n int64) error {
+	redisKey, field := c.counterKey(key, currentWindow, windowLength)
+	if c.noTTL {
+		if field != "" {
+			return client.Do(ctx, client.B().Hincrby().Key(redisKey).Field(field).Increment(n).Build()).Error()
+		}
+		return client.Do(ctx, client.B().Incrby().Key(redisKey).Increment(n).Build()).Error()
+	}
+
+	args := []string{c.expiryMillis(currentWindow, windowLength), strconv.FormatInt(n, 10)}
+	s, function := incrementScript, "httprate_increment"
+	if field != "" {
+		args = append(args, field)
+		s, function = incrementFieldScript, "httprate_increment_field"
+	}
+
+	if fcall {
+		err := client.Do(ctx, client.B().Fcall().Function(function).Numkeys(1).Key(redisKey).Arg(args...).Build()).Error()
+		var redisErr *rueidis.RedisError
+		if !errors.As(err, &redisErr) || !strings.Contains(redisErr.Error(), "Function not found") {
+			return err
+		}
+	}
+	return s.Exec(ctx, client, []string{redisKey}, args).Error()
+}
+
+func (c *RedisLimitCounter) get(ctx context.Context, key string, currentWindow, previousWindow time.Time, windowLength time.Duration) (int, int, error) {
+	cmdCtx, cancel := c.commandContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	var result []rueidis.RedisResult
+	if ttl := c.clientCacheTTL(windowLength); ttl > 0 {
+		result = c.reader.DoMultiCache(cmdCtx, c.getCacheCommands(key, windowLength, ttl, currentWindow, previousWindow)...)
+	} else {
+		result = c.reader.DoMulti(cmdCtx, c.getCommands(key, windowLength, currentWindow, previousWindow)...)
+	}
+	if err := c.observeCommand(ctx, cmdCtx, "GET", start, multiError(result)); errors.Is(err, ErrCommandTimeout) {
+		return 0, 0, fmt.Errorf("redis get failed: %w", classify(err))
+	}
+	if err := checkReplies(len(result), 2); err != nil {
+		return 0, 0, fmt.Errorf("redis get failed: %w", err)
+	}
+	if c.strictExisting && errors.Is(result[0].Error(), rueidis.Nil) && errors.Is(result[1].Error(), rueidis.Nil) {
+		return 0, 0, ErrKeyNotFound
+	}
+
+	currKey, currField := c.counterKey(key, currentWindow, windowLength)
+	curr, err := c.windowCount(ctx, result[0], "current", currKey, currField)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	prevKey, prevField := c.counterKey(key, previousWindow, windowLength)
+	prev, err := c.windowCount(ctx, result[1], "previous", prevKey, prevField)
 	if err != nil {
-		return 0, 0, fmt.Errorf("redis int value: %w", err)
+		return 0, 0, err
+	}
+
+	return curr, prev, nil
+}
+
+// getCommands returns the commands reading the counts of key in windows
+// of windowLength
+func (c *RedisLimitCounter) getCommands(key string, windowLength time.Duration, windows ...time.Time) rueidis.Commands {
+	cmds := make(rueidis.Commands, 0, len(windows))
+	for _, window := range windows {
+		if redisKey, field := c.counterKey(key, window, windowLength); field != "" {
+			cmds = append(cmds, c.reader.B().Hget().Key(redisKey).Field(field).Build())
+		} else {
+			cmds = append(cmds, c.reader.B().Get().Key(redisKey).Build())
+		}
+	}
+	return cmds
+}
+
+// getCacheCommands returns the getCommands served from the client-side
+// cache for ttl
+func (c *RedisLimitCounter) getCacheCommands(key string, windowLength, ttl time.Duration, windows ...time.Time) []rueidis.CacheableTTL {
+	cmds := make([]rueidis.CacheableTTL, 0, len(windows))
+	for _, window := range windows {
+		if redisKey, field := c.counterKey(key, window, windowLength); field != "" {
+			cmds = append(cmds, rueidis.CT(c.reader.B().Hget().Key(redisKey).Field(field).Cache(), ttl))
+		} else {
+			cmds = append(cmds, rueidis.CT(c.reader.B().Get().Key(redisKey).Cache(), ttl))
+		}
+	}
+	return cmds
+}
+
+// clientCacheTTL returns the client-side cache TTL for Get reads of windows
+// of windowLength, or zero when caching is disabled
+func (c *RedisLimitCounter) clientCacheTTL(windowLength time.Duration) time.Duration {
+	if max := windowLength / 10; c.cacheTTL > max {
+		return max
+	}
+	return c.cacheTTL
+}
+
+// IncrementAndGet increments the current window count of key and returns
+// the incremented count along with the previous window count, in a single
+// atomic round-trip. Both window keys must map to the same slot, so this
+// requires ClusterMode, or a KeyFunc hash-tagging keys, and fails with
+// ErrCrossSlot otherwise.
+func (c *RedisLimitCounter) IncrementAndGet(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	if c.windowLength <= 0 {
+		return 0, 0, errors.New("redis increment failed: counter is not configured")
+	}
+
+	keys := []string{c.limitCounterKey(key, currentWindow), c.limitCounterKey(key, previousWindow)}
+	if err := checkSlot(keys...); err != nil {
+		return 0, 0, fmt.Errorf("redis increment failed: %w", err)
+	}
+
+	ctx, cancel := c.opContext(c.ctx)
+	defer cancel()
+
+	result, err := incrementAndGetScript.Exec(ctx, c.client, keys,
+		[]string{c.expiryMillis(currentWindow, c.windowLength)},
+	).AsIntSlice()
+	if err != nil {
+		return 0, 0, fmt.Errorf("redis increment failed: %w", classify(err))
+	}
+	if err := checkReplies(len(result), 2); err != nil {
+		return 0, 0, fmt.Errorf("redis increment failed: %w", err)
+	}
+
+	return int(result[0]), int(result[1]), nil
+}
+
+// IncrementIdempotent increments the current window count of key unless
+// idempotencyKey has already been counted for it in the same window within
+// IdempotencyTTL, so that retried requests aren't counted twice. It returns
+// whether the count was incremented.
+func (c *RedisLimitCounter) IncrementIdempotent(key, idempotencyKey string, currentWindow time.Time) (bool, error) {
+	if c.windowLength <= 0 {
+		return false, errors.New("redis increment failed: counter is not configured")
+	}
+
+	hkey := c.limitCounterKey(key, currentWindow)
+	// both keys are set by one script, so must be in the same cluster slot:
+	// a counter key without a hash tag, as outside of ClusterMode, becomes
+	// the hash tag of the idempotency key
+	tag := hkey
+	if _, ok := hashTag(hkey); !ok {
+		tag = "{" + hkey + "}"
+	}
+	ikey := fmt.Sprintf("%s:idem:%d", tag, xxhash.Sum64String(idempotencyKey))
+	if err := checkSlot(hkey, ikey); err != nil {
+		return false, fmt.Errorf("redis increment failed: %w", err)
+	}
+
+	ctx, cancel := c.opContext(c.ctx)
+	defer cancel()
+
+	incremented, err := incrementIdempotentScript.Exec(ctx, c.client,
+		[]string{hkey, ikey},
+		[]string{c.expiryMillis(currentWindow, c.windowLength), "1", strconv.FormatInt(c.idemTTL.Milliseconds(), 10)},
+	).AsInt64()
+	if err != nil {
+		return false, fmt.Errorf("redis increment failed: %w", classify(err))
+	}
+	return incremented == 1, nil
+}
+
+// IncrementMulti increments the current window count of every key in a
+// single round-trip.
+func (c *RedisLimitCounter) IncrementMulti(keys []string, currentWindow time.Time) error {
+	if c.windowLength <= 0 {
+		return errors.New("redis increment failed: counter is not configured")
+	}
+
+	ttl := c.expiryMillis(currentWindow, c.windowLength)
+
+	multi := make([]rueidis.LuaExec, len(keys))
+	for i, key := range keys {
+		multi[i] = rueidis.LuaExec{Keys: []string{c.limitCounterKey(key, currentWindow)}, Args: []string{ttl, "1"}}
+	}
+
+	ctx, cancel := c.opContext(c.ctx)
+	defer cancel()
+
+	result := incrementScript.execMulti(ctx, c.client, multi...)
+	if err := checkReplies(len(result), len(multi)); err != nil {
+		return fmt.Errorf("redis increment failed: %w", err)
+	}
+	for i, response := range result {
+		if err := response.Error(); err != nil {
+			return fmt.Errorf("redis increment of key %d failed: %w", i, classify(err))
+		}
+	}
+
+	return nil
+}
+
+// GetMulti returns the current and previous window counts of every key in a
+// single round-trip, in the order of keys.
+func (c *RedisLimitCounter) GetMulti(keys []string, currentWindow, previousWindow time.Time) ([]int, []int, error) {
+	cmds := make(rueidis.Commands, 0, len(keys)*2)
+	for _, key := range keys {
+		cmds = append(cmds,
+			c.reader.B().Get().Key(c.limitCounterKey(key, currentWindow)).Build(),
+			c.reader.B().Get().Key(c.limitCounterKey(key, previousWindow)).Build(),
+		)
+	}
+
+	ctx, cancel := c.opContext(c.ctx)
+	defer cancel()
+
+	result := c.reader.DoMulti(ctx, cmds...)
+	if err := checkReplies(len(result), len(cmds)); err != nil {
+		return nil, nil, fmt.Errorf("redis get failed: %w", err)
 	}
 
-	prev, err := result[1].ToInt64()
+	curr := make([]int, len(keys))
+	prev := make([]int, len(keys))
+	for i, key := range keys {
+		var err error
+		if curr[i], err = c.windowCount(ctx, result[i*2], fmt.Sprintf("key %d current", i), c.limitCounterKey(key, currentWindow), ""); err != nil {
+			return nil, nil, err
+		}
+		if prev[i], err = c.windowCount(ctx, result[i*2+1], fmt.Sprintf("key %d previous", i), c.limitCounterKey(key, previousWindow), ""); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return curr, prev, nil
+}
+
+// multiError returns the first error among responses, ignoring missing keys
+func multiError(responses []rueidis.RedisResult) error {
+	for _, response := range responses {
+		if err := response.Error(); err != nil && !errors.Is(err, rueidis.Nil) {
+			return err
+		}
+	}
+	return nil
+}
+
+// windowCount parses the GET response of the window counter at redisKey,
+// or at field of it when field is set, treating a missing key as zero. A
+// value that isn't an integer is deleted and treated as zero with
+// RecoverCorruptKeys.
+func (c *RedisLimitCounter) windowCount(ctx context.Context, response rueidis.RedisResult, window, redisKey, field string) (int, error) {
+	if err := response.Error(); err != nil {
+		if errors.Is(err, rueidis.Nil) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("redis get of %s window failed: %w", window, classify(err))
+	}
+
+	v, err := response.AsInt64()
+	if err == nil {
+		return int(v), nil
+	}
+
+	desc := redisKey
+	if field != "" {
+		desc += " field " + field
+	}
+	raw, _ := response.ToString()
+	err = fmt.Errorf("redis value %q of %s window key %s is not an integer: %w: %w", raw, window, desc, ErrCommand, err)
+	if !c.recoverCorrupt {
+		return 0, err
+	}
+
+	c.reportError("redis deleted corrupt counter", desc, err)
+	del := c.client.B().Del().Key(redisKey).Build()
+	if field != "" {
+		del = c.client.B().Hdel().Key(redisKey).Field(field).Build()
+	}
+	if err := c.client.Do(ctx, del).Error(); err != nil {
+		return 0, fmt.Errorf("redis delete of corrupt %s window failed: %w", window, classify(err))
+	}
+	return 0, nil
+}
+
+// Reset clears the current and previous window counts of key.
+func (c *RedisLimitCounter) Reset(key string) error {
+	if c.windowLength <= 0 {
+		return errors.New("redis reset failed: counter is not configured")
+	}
+
+	currentWindow := c.currentWindow()
+	previousWindow := currentWindow.Add(-c.windowLength)
+
+	ctx, cancel := c.opContext(c.ctx)
+	defer cancel()
+
+	for _, response := range c.client.DoMulti(ctx, c.deleteCommands(key, c.windowLength, currentWindow, previousWindow)...) {
+		if err := response.Error(); err != nil {
+			return fmt.Errorf("redis reset failed: %w", classify(err))
+		}
+	}
+
+	return nil
+}
+
+// KeyTTL returns how long until the current window key of key expires. It
+// returns ErrKeyNotFound if key hasn't been incremented in the current
+// window, and ErrNoExpiry if its key was written without an expiry.
+// It ignores UseHashField, where counts live in a per-window hash instead,
+// so with it set KeyTTL always returns ErrKeyNotFound.
+func (c *RedisLimitCounter) KeyTTL(key string) (time.Duration, error) {
+	if c.windowLength <= 0 {
+		return 0, errors.New("redis ttl failed: counter is not configured")
+	}
+
+	ctx, cancel := c.opContext(c.ctx)
+	defer cancel()
+
+	pttl := c.reader.B().Pttl().Key(c.limitCounterKey(key, c.currentWindow())).Build()
+	ms, err := c.reader.Do(ctx, pttl).AsInt64()
 	if err != nil {
-		return 0, 0, fmt.Errorf("redis int value: %w", err)
+		return 0, fmt.Errorf("redis ttl failed: %w", classify(err))
+	}
+
+	switch ms {
+	case -2:
+		return 0, ErrKeyNotFound
+	case -1:
+		return 0, ErrNoExpiry
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// FlushAll deletes every key under the configured prefix, on every node,
+// without touching other keys in the database. Keys are found with SCAN
+// and deleted in batches, so the server isn't blocked. Keys built by a
+// KeyFunc are only deleted if they start with the prefix.
+func (c *RedisLimitCounter) FlushAll(ctx context.Context) error {
+	pattern := escapeGlob(c.prefix) + "*"
+	for _, node := range c.client.Nodes() {
+		if err := c.flushNode(ctx, node, pattern); err != nil {
+			return fmt.Errorf("redis flush failed: %w", classify(err))
+		}
+	}
+	return nil
+}
+
+// flushNode deletes the keys matching pattern on node. Deletes go through
+// the counter's client, so that they reach the node owning each key.
+func (c *RedisLimitCounter) flushNode(ctx context.Context, node rueidis.Client, pattern string) error {
+	var cursor uint64
+	for {
+		entry, err := node.Do(ctx, node.B().Scan().Cursor(cursor).Match(pattern).Count(100).Build()).AsScanEntry()
+		if err != nil {
+			return err
+		}
+
+		if len(entry.Elements) > 0 {
+			unlinks := make(rueidis.Commands, 0, len(entry.Elements))
+			for _, key := range entry.Elements {
+				unlinks = append(unlinks, c.client.B().Unlink().Key(key).Build())
+			}
+			for _, response := range c.client.DoMulti(ctx, unlinks...) {
+				if err := response.Error(); err != nil {
+					return err
+				}
+			}
+		}
+
+		if entry.Cursor == 0 {
+			return nil
+		}
+		cursor = entry.Cursor
 	}
+}
 
-	return int(curr), int(prev), nil
+// escapeGlob escapes the SCAN MATCH pattern characters in s
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// GetCount returns the count of key in the current window, without
+// incrementing it.
+func (c *RedisLimitCounter) GetCount(key string) (int, error) {
+	if c.windowLength <= 0 {
+		return 0, errors.New("redis get failed: counter is not configured")
+	}
+
+	ctx, cancel := c.opContext(c.ctx)
+	defer cancel()
+
+	currentWindow := c.currentWindow()
+	redisKey, field := c.counterKey(key, currentWindow, c.windowLength)
+	return c.windowCount(ctx, c.reader.Do(ctx, c.getCommands(key, c.windowLength, currentWindow)[0]), "current", redisKey, field)
+}
+
+// expiryMillis returns the TTL in milliseconds to set on a new counter key for
+// currentWindow, so that it expires ExpiryMultiplier window lengths after
+// the window started rather than after it was first incremented. Jitter is
+// only ever added, so the previous window stays readable.
+func (c *RedisLimitCounter) expiryMillis(currentWindow time.Time, windowLength time.Duration) string {
+	expireAt := currentWindow.Add(time.Duration(float64(windowLength) * c.expiry))
+	if c.jitter > 0 {
+		expireAt = expireAt.Add(time.Duration(c.randInt63n(int64(c.jitter) + 1)))
+	}
+	ttl := expireAt.Sub(c.clock()).Milliseconds()
+	if ttl < 1 {
+		ttl = 1
+	}
+	return strconv.FormatInt(ttl, 10)
+}
+
+// checkKey returns ErrEmptyKey for an empty key if RejectEmptyKeys is set
+func (c *RedisLimitCounter) checkKey(key string) error {
+	if c.rejectEmptyKeys && key == "" {
+		return ErrEmptyKey
+	}
+	return nil
+}
+
+// currentWindow returns the start of the window httprate is currently counting in
+func (c *RedisLimitCounter) currentWindow() time.Time {
+	return c.clock().UTC().Truncate(c.windowLength)
+}
+
+// opContext returns the context a single operation, including its retries,
+// is bound by
+func (c *RedisLimitCounter) opContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
 }
 
 // limitCounterKey returns the current limit counter key
-func limitCounterKey(key string, window time.Time) string {
-	return fmt.Sprintf("httprate:%d", httprate.LimitCounterKey(key, window))
+func (c *RedisLimitCounter) limitCounterKey(key string, window time.Time) string {
+	if c.hashKeys {
+		key = hashKey(key)
+	}
+	if c.keyFunc != nil {
+		return c.keyFunc(key, window)
+	}
+
+	// built by hand rather than with fmt.Sprintf, as this runs up to three
+	// times per request
+	var num [20]byte
+	var b strings.Builder
+	b.Grow(len(c.prefix) + len("v1:{}:") + 2*len(num))
+	b.WriteString(c.prefix)
+	if c.keyVersion == KeyFormatV1 {
+		b.WriteString("v1:")
+	}
+	switch {
+	case c.cluster:
+		b.WriteByte('{')
+		b.Write(strconv.AppendUint(num[:0], xxhash.Sum64String(key), 10))
+		b.WriteString("}:")
+		b.Write(strconv.AppendInt(num[:0], window.Unix(), 10))
+	case c.keyVersion == KeyFormatV1:
+		b.Write(strconv.AppendUint(num[:0], windowKeyHash(key, window), 10))
+	default:
+		b.Write(strconv.AppendUint(num[:0], httprate.LimitCounterKey(key, window), 10))
+	}
+	return b.String()
+}
+
+// counterKey returns the Redis key storing the count of key in window, and
+// its hash field with UseHashField.
+func (c *RedisLimitCounter) counterKey(key string, window time.Time, windowLength time.Duration) (string, string) {
+	if c.hashField {
+		return c.windowField(key, window, windowLength)
+	}
+	return c.windowKey(key, window, windowLength), ""
+}
+
+// windowKey returns the Redis key of key in window. Windows of a length
+// other than the configured one, from IncrementWindow, Allow or a route
+// namespace, are suffixed with it by quotaKey, so that windows of different
+// lengths starting at the same instant don't share a counter.
+func (c *RedisLimitCounter) windowKey(key string, window time.Time, windowLength time.Duration) string {
+	if windowLength != c.windowLength {
+		return quotaKey(c.limitCounterKey(key, window), windowLength)
+	}
+	return c.limitCounterKey(key, window)
+}
+
+// deleteCommands returns the commands deleting the counters of key in
+// windows of windowLength
+func (c *RedisLimitCounter) deleteCommands(key string, windowLength time.Duration, windows ...time.Time) rueidis.Commands {
+	cmds := make(rueidis.Commands, 0, len(windows))
+	for _, window := range windows {
+		if redisKey, field := c.counterKey(key, window, windowLength); field != "" {
+			cmds = append(cmds, c.client.B().Hdel().Key(redisKey).Field(field).Build())
+		} else {
+			cmds = append(cmds, c.client.B().Del().Key(redisKey).Build())
+		}
+	}
+	return cmds
+}
+
+// windowField returns the hash holding every counter of window, and the
+// field of key in it, for UseHashField. The hash key includes windowLength,
+// so that windows of different lengths starting at the same instant don't
+// share a hash, or its TTL.
+func (c *RedisLimitCounter) windowField(key string, window time.Time, windowLength time.Duration) (string, string) {
+	if c.hashKeys {
+		key = hashKey(key)
+	}
+	return fmt.Sprintf("%sh:%d:%d", c.prefix, windowLength.Milliseconds(), window.Unix()), strconv.FormatUint(xxhash.Sum64String(key), 10)
+}
+
+// hashKey returns a fixed-length digest of key
+func hashKey(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:8])
 }
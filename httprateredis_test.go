@@ -0,0 +1,1250 @@
+package httprateredis
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/httprate"
+	"github.com/golang/mock/gomock"
+	"github.com/rueian/rueidis"
+	"github.com/rueian/rueidis/mock"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDefaultAddress(t *testing.T) {
+	opts, err := buildClientOption(&Config{})
+	if err != nil {
+		t.Fatalf("buildClientOption: %v", err)
+	}
+	if len(opts.InitAddress) != 1 || opts.InitAddress[0] != DefaultAddress {
+		t.Errorf("empty config connects to %v, want %s", opts.InitAddress, DefaultAddress)
+	}
+}
+
+func TestNilConfigConnects(t *testing.T) {
+	mr := miniredis.NewMiniRedis()
+	if err := mr.StartAddr(DefaultAddress); err != nil {
+		t.Skipf("%s is in use: %v", DefaultAddress, err)
+	}
+	defer mr.Close()
+
+	for name, cfg := range map[string]*Config{"nil": nil, "empty": {}} {
+		c, err := NewRedisLimitCounter(cfg)
+		if err != nil {
+			t.Fatalf("NewRedisLimitCounter with a %s config: %v", name, err)
+		}
+		c.Config(10, time.Minute)
+		if err := c.Increment("key", time.Now().UTC().Truncate(time.Minute)); err != nil {
+			t.Errorf("Increment with a %s config: %v", name, err)
+		}
+		c.Close()
+	}
+	for _, key := range mr.Keys() {
+		if !strings.HasPrefix(key, DefaultPrefix) {
+			t.Errorf("key %s isn't under DefaultPrefix", key)
+		}
+	}
+}
+
+func TestZeroConfigDefaults(t *testing.T) {
+	cfg := &Config{}
+	c := newRedisLimitCounter(nil, cfg)
+	c.Config(10, time.Minute)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c.clock = fixedClock(start)
+
+	if key := c.limitCounterKey("key", start); !strings.HasPrefix(key, DefaultPrefix) {
+		t.Errorf("key = %s, want it under DefaultPrefix %s", key, DefaultPrefix)
+	}
+	if got, want := c.expiryMillis(start, time.Minute), strconv.FormatInt((DefaultExpiryMultiplier*time.Minute).Milliseconds(), 10); got != want {
+		t.Errorf("expiry = %sms, want DefaultExpiryMultiplier windows, %sms", got, want)
+	}
+	// the defaults are applied to a copy, leaving the caller's config zero
+	if !reflect.DeepEqual(cfg, &Config{}) {
+		t.Errorf("config was changed to %+v", cfg)
+	}
+}
+
+func TestBadAddress(t *testing.T) {
+	for _, addr := range []string{"localhost", "", "127.0.0.1:6379:1"} {
+		if _, err := NewRedisLimitCounter(&Config{Addresses: []string{addr}}); err == nil {
+			t.Errorf("NewRedisLimitCounter(%q) succeeded", addr)
+		}
+		if _, err := WithRedisLimitCounter(&Config{Addresses: []string{addr}}); err == nil {
+			t.Errorf("WithRedisLimitCounter(%q) succeeded", addr)
+		}
+	}
+}
+
+func TestUnreachableAddress(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	_, err = NewRedisLimitCounter(&Config{Addresses: []string{addr}})
+	if err == nil || !strings.HasPrefix(err.Error(), "unable to connect to redis: ") {
+		t.Errorf("NewRedisLimitCounter of closed %s = %v, want an unable to connect error", addr, err)
+	}
+	_, err = WithRedisLimitCounter(&Config{Addresses: []string{addr}})
+	if err == nil || !strings.HasPrefix(err.Error(), "unable to connect to redis: ") {
+		t.Errorf("WithRedisLimitCounter of closed %s = %v, want an unable to connect error", addr, err)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	custom := &tls.Config{ServerName: "redis.internal"}
+	tests := []struct {
+		name string
+		cfg  *Config
+		want func(*tls.Config) bool
+	}{
+		{"off", &Config{}, func(c *tls.Config) bool { return c == nil }},
+		{"enabled", &Config{EnableTLS: true}, func(c *tls.Config) bool { return c != nil && c.MinVersion == tls.VersionTLS12 }},
+		{"custom", &Config{TLSConfig: custom}, func(c *tls.Config) bool { return c == custom }},
+		{"custom wins", &Config{TLSConfig: custom, EnableTLS: true}, func(c *tls.Config) bool { return c == custom }},
+	}
+	for _, tt := range tests {
+		opts, err := buildClientOption(tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !tt.want(opts.TLSConfig) {
+			t.Errorf("%s: TLSConfig = %+v", tt.name, opts.TLSConfig)
+		}
+	}
+}
+
+func TestUsername(t *testing.T) {
+	opts, err := buildClientOption(&Config{Username: "limiter", Password: "secret"})
+	if err != nil {
+		t.Fatalf("buildClientOption: %v", err)
+	}
+	if opts.Username != "limiter" || opts.Password != "secret" {
+		t.Errorf("credentials = %q, %q, want limiter, secret", opts.Username, opts.Password)
+	}
+
+	mr := miniredis.RunT(t)
+	mr.RequireUserAuth("limiter", "secret")
+
+	c, err := NewRedisLimitCounter(&Config{Addresses: []string{mr.Addr()}, Username: "limiter", Password: "secret"})
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounter with the ACL user: %v", err)
+	}
+	c.Close()
+
+	if _, err := NewRedisLimitCounter(&Config{Addresses: []string{mr.Addr()}, Username: "other", Password: "secret"}); err == nil {
+		t.Error("NewRedisLimitCounter with an unknown user succeeded")
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	c, _ := newTestCounter(t, nil)
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("first Close: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Minute)
+	if err := c.Increment("key", now); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Increment after Close = %v, want ErrShuttingDown", err)
+	}
+	if _, _, err := c.Get("key", now, now.Add(-time.Minute)); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Get after Close = %v, want ErrShuttingDown", err)
+	}
+}
+
+func TestWithClientLeavesConnectionAlone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mock.NewClient(ctrl)
+
+	// gomock fails the test on any call on the client, such as Close
+	c := NewRedisLimitCounterWithClient(client)
+	if c.Client() != client {
+		t.Error("Client isn't the client the counter was made with")
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	_ = WithRedisLimitCounterClient(client)
+}
+
+func TestClientIsTheCountersClient(t *testing.T) {
+	c, mr := newTestCounter(t, nil)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	client := c.Client()
+	if client != c.Client() {
+		t.Fatal("Client returned different clients")
+	}
+
+	// commands run on it see the counter's keys
+	if err := c.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	n, err := client.Do(context.Background(), client.B().Get().Key(c.limitCounterKey("key", now)).Build()).AsInt64()
+	if err != nil || n != 1 {
+		t.Errorf("GET on Client = %d, %v, want 1, nil", n, err)
+	}
+	if got := mr.CurrentConnectionCount(); got != 1 {
+		t.Errorf("%d connections open, want the counter's 1", got)
+	}
+}
+
+func TestPrefixKey(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	for _, tt := range []struct{ prefix, want string }{
+		{"", DefaultPrefix},
+		{"myapp:", "myapp:"},
+	} {
+		c, mr := newTestCounter(t, &Config{PrefixKey: tt.prefix})
+		if err := c.Increment("key", now); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+		keys := mr.Keys()
+		if len(keys) != 1 || !strings.HasPrefix(keys[0], tt.want) {
+			t.Errorf("PrefixKey %q: keys = %q, want one starting with %q", tt.prefix, keys, tt.want)
+		}
+	}
+}
+
+func TestNewRedisLimitCounterContext(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if _, err := NewRedisLimitCounterContext(ctx, &Config{Addresses: []string{mr.Addr()}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("with a cancelled context = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("with a cancelled context took %v", elapsed)
+	}
+	if n := mr.CurrentConnectionCount(); n != 0 {
+		t.Errorf("with a cancelled context %d connections were made", n)
+	}
+
+	c, err := NewRedisLimitCounterContext(context.Background(), &Config{Addresses: []string{mr.Addr()}})
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounterContext: %v", err)
+	}
+	c.Close()
+}
+
+func TestCancelledBaseContext(t *testing.T) {
+	c, _ := newTestCounter(t, nil)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.SetBaseContext(ctx)
+
+	if err := c.Increment("key", now); !errors.Is(err, context.Canceled) {
+		t.Errorf("Increment = %v, want context.Canceled", err)
+	}
+	if _, _, err := c.Get("key", now, now.Add(-time.Minute)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get = %v, want context.Canceled", err)
+	}
+}
+
+// blockingClient returns a mock client whose commands block until their
+// context is done
+func blockingClient(t *testing.T) *mock.Client {
+	t.Helper()
+	client := mock.NewClient(gomock.NewController(t))
+	block := func(ctx context.Context) rueidis.RedisResult {
+		<-ctx.Done()
+		return mock.ErrorResult(ctx.Err())
+	}
+	client.EXPECT().Do(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, cmd any) rueidis.RedisResult { return block(ctx) }).AnyTimes()
+	client.EXPECT().DoMulti(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, cmds ...any) []rueidis.RedisResult {
+		return []rueidis.RedisResult{block(ctx), block(ctx)}
+	}).AnyTimes()
+	return client
+}
+
+func TestTimeoutIsWrapped(t *testing.T) {
+	c := NewRedisLimitCounterWithClient(blockingClient(t))
+	c.timeout = 20 * time.Millisecond
+	c.Config(10, time.Minute)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	err := c.Increment("key", now)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.HasPrefix(err.Error(), "redis increment failed: ") {
+		t.Errorf("Increment = %v, want a wrapped context.DeadlineExceeded", err)
+	}
+	_, _, err = c.Get("key", now, now.Add(-time.Minute))
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.HasPrefix(err.Error(), "redis get ") {
+		t.Errorf("Get = %v, want a wrapped context.DeadlineExceeded", err)
+	}
+}
+
+func TestGetMissingWindows(t *testing.T) {
+	c, _ := newTestCounter(t, nil)
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+
+	curr, prevCount, err := c.Get("key", now, prev)
+	if err != nil || curr != 0 || prevCount != 0 {
+		t.Errorf("Get of a new key = %d, %d, %v, want 0, 0, nil", curr, prevCount, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.Increment("key", now); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+	curr, prevCount, err = c.Get("key", now, prev)
+	if err != nil || curr != 2 || prevCount != 0 {
+		t.Errorf("Get without a previous window = %d, %d, %v, want 2, 0, nil", curr, prevCount, err)
+	}
+}
+
+func TestWindowCount(t *testing.T) {
+	c := NewRedisLimitCounterWithClient(nil)
+	ctx := context.Background()
+
+	if n, err := c.windowCount(ctx, mock.Result(mock.RedisNil()), "current", "key", ""); n != 0 || err != nil {
+		t.Errorf("windowCount of a missing key = %d, %v, want 0, nil", n, err)
+	}
+	if n, err := c.windowCount(ctx, mock.Result(mock.RedisString("7")), "current", "key", ""); n != 7 || err != nil {
+		t.Errorf("windowCount of 7 = %d, %v, want 7, nil", n, err)
+	}
+	// a wrapped Nil is still a missing key
+	if n, err := c.windowCount(ctx, mock.ErrorResult(fmt.Errorf("get: %w", rueidis.Nil)), "current", "key", ""); n != 0 || err != nil {
+		t.Errorf("windowCount of a wrapped Nil = %d, %v, want 0, nil", n, err)
+	}
+}
+
+func TestGetNamesTheFailedWindow(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		results []rueidis.RedisResult
+		want    string
+	}{
+		{"current", []rueidis.RedisResult{mock.ErrorResult(errBroken), mock.Result(mock.RedisNil())}, "redis get of current window failed: "},
+		{"previous", []rueidis.RedisResult{mock.Result(mock.RedisInt64(1)), mock.ErrorResult(errBroken)}, "redis get of previous window failed: "},
+		{"reply", []rueidis.RedisResult{mock.Result(mock.RedisInt64(1)), mock.Result(mock.RedisError("WRONGTYPE Operation against a key holding the wrong kind of value"))}, "redis get of previous window failed: "},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := mock.NewClient(gomock.NewController(t))
+			client.EXPECT().DoMulti(gomock.Any(), gomock.Any()).Return(tt.results)
+			c := newRedisLimitCounter(client, &Config{})
+			c.Config(10, time.Minute)
+			now := time.Now().UTC().Truncate(time.Minute)
+
+			_, _, err := c.Get("key", now, now.Add(-time.Minute))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Get = %v, want an error starting %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// the TTL is set by the same command as the increment, so there's no
+// partial success of an INCR without its EXPIRE to report
+func TestIncrementIsOneCommand(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"script", Config{}, "EVALSHA"},
+		{"no ttl", Config{DisableTTL: true}, "INCRBY"},
+		{"no ttl hash field", Config{DisableTTL: true, UseHashField: true}, "HINCRBY"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := mock.NewClient(gomock.NewController(t))
+			client.EXPECT().Do(gomock.Any(), mock.MatchFn(func(cmd []string) bool { return cmd[0] == tt.want }, tt.want)).Return(mock.ErrorResult(errBroken))
+			c := newRedisLimitCounter(client, &tt.cfg)
+			c.Config(10, time.Minute)
+
+			err := c.Increment("key", time.Now().UTC().Truncate(time.Minute))
+			if !errors.Is(err, errBroken) || !strings.HasPrefix(err.Error(), "redis increment failed: ") {
+				t.Errorf("Increment = %v, want a wrapped errBroken", err)
+			}
+		})
+	}
+}
+
+func TestDisableTTL(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	for _, hashField := range []bool{false, true} {
+		c, mr := newTestCounter(t, &Config{DisableTTL: true, UseHashField: hashField})
+		for i := 0; i < 3; i++ {
+			if err := c.Increment("key", now); err != nil {
+				t.Fatalf("Increment: %v", err)
+			}
+		}
+		if curr, _, err := c.Get("key", now, now.Add(-time.Minute)); err != nil || curr != 3 {
+			t.Errorf("hash field %v: Get = %d, %v, want 3, nil", hashField, curr, err)
+		}
+		key, _ := c.counterKey("key", now, time.Minute)
+		if ttl := mr.TTL(key); ttl != 0 {
+			t.Errorf("hash field %v: TTL = %v, want none", hashField, ttl)
+		}
+	}
+
+	// nothing but the increment is sent
+	client := mock.NewClient(gomock.NewController(t))
+	c := newRedisLimitCounter(client, &Config{DisableTTL: true})
+	c.Config(10, time.Minute)
+	key := c.limitCounterKey("key", now)
+	client.EXPECT().Do(gomock.Any(), mock.Match("INCRBY", key, "1")).Return(mock.Result(mock.RedisInt64(1)))
+	if err := c.Increment("key", now); err != nil {
+		t.Errorf("Increment = %v", err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	c := NewRedisLimitCounterWithClient(nil)
+	c.Config(42, 30*time.Second)
+
+	if got := c.RequestLimit(); got != 42 {
+		t.Errorf("RequestLimit = %d, want 42", got)
+	}
+	if got := c.WindowLength(); got != 30*time.Second {
+		t.Errorf("WindowLength = %v, want 30s", got)
+	}
+}
+
+func TestTTLSetOnce(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	c, mr := newTestCounter(t, &Config{Clock: func() time.Time { return now }})
+	hkey := c.limitCounterKey("key", start)
+
+	if err := c.Increment("key", start); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if got, want := mr.TTL(hkey), 3*time.Minute; got != want {
+		t.Fatalf("TTL = %v, want %v", got, want)
+	}
+
+	// a later increment in the same window leaves the TTL alone
+	now = start.Add(40 * time.Second)
+	if err := c.Increment("key", start); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if got, want := mr.TTL(hkey), 3*time.Minute; got != want {
+		t.Errorf("TTL after a second increment = %v, want %v", got, want)
+	}
+}
+
+func TestClockRollover(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start.Add(50 * time.Second)
+	c, mr := newTestCounter(t, &Config{Clock: func() time.Time { return now }})
+	next := start.Add(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if err := c.Increment("key", start); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+	if n, err := c.GetCount("key"); err != nil || n != 3 {
+		t.Fatalf("GetCount = %d, %v, want 3, nil", n, err)
+	}
+
+	// crossing into the next window starts its count from zero
+	now = next
+	if n, err := c.GetCount("key"); err != nil || n != 0 {
+		t.Errorf("GetCount after rollover = %d, %v, want 0, nil", n, err)
+	}
+	if err := c.Increment("key", next); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if curr, prev, err := c.Get("key", next, start); err != nil || curr != 1 || prev != 3 {
+		t.Errorf("Get after rollover = %d, %d, %v, want 1, 3, nil", curr, prev, err)
+	}
+
+	// the first window's key was set to expire three window lengths after
+	// it started, measured from the frozen clock
+	if got, want := mr.TTL(c.limitCounterKey("key", start)), 3*time.Minute-50*time.Second; got != want {
+		t.Errorf("first window TTL = %v, want %v", got, want)
+	}
+	mr.FastForward(3*time.Minute - 50*time.Second)
+	if curr, prev, err := c.Get("key", next, start); err != nil || curr != 1 || prev != 0 {
+		t.Errorf("Get after the first window expired = %d, %d, %v, want 1, 0, nil", curr, prev, err)
+	}
+}
+
+func TestReadAddresses(t *testing.T) {
+	primary, replica := miniredis.RunT(t), miniredis.RunT(t)
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+	c, err := NewRedisLimitCounter(&Config{
+		Addresses:     []string{primary.Addr()},
+		ReadAddresses: []string{replica.Addr()},
+		Clock:         fixedClock(now),
+	})
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounter: %v", err)
+	}
+	defer c.Close()
+	c.Config(10, time.Minute)
+
+	// increments are written to the primary only
+	if err := c.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	key := c.limitCounterKey("key", now)
+	if !primary.Exists(key) || replica.Exists(key) {
+		t.Fatalf("key on primary %v, replica %v, want the primary only", primary.Exists(key), replica.Exists(key))
+	}
+
+	// and counts are read from the replica, here lagging behind
+	if curr, _, err := c.Get("key", now, prev); err != nil || curr != 0 {
+		t.Errorf("Get before replication = %d, %v, want 0, nil", curr, err)
+	}
+	replica.Set(key, "1")
+	replica.Set(c.limitCounterKey("key", prev), "4")
+	if curr, prevCount, err := c.Get("key", now, prev); err != nil || curr != 1 || prevCount != 4 {
+		t.Errorf("Get after replication = %d, %d, %v, want 1, 4, nil", curr, prevCount, err)
+	}
+	if n, err := c.GetCount("key"); err != nil || n != 1 {
+		t.Errorf("GetCount = %d, %v, want 1, nil", n, err)
+	}
+}
+
+func TestMirrorAddresses(t *testing.T) {
+	primary, mirror := miniredis.RunT(t), miniredis.RunT(t)
+	now := time.Now().UTC().Truncate(time.Minute)
+	logger := &testLogger{}
+	c, err := NewRedisLimitCounter(&Config{
+		Addresses:       []string{primary.Addr()},
+		MirrorAddresses: []string{mirror.Addr()},
+		Clock:           fixedClock(now),
+		Logger:          logger,
+	})
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounter: %v", err)
+	}
+	defer c.Close()
+	c.Config(10, time.Minute)
+
+	// increments are written to both
+	if err := c.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	c.drain.inflight.Wait()
+	key := c.limitCounterKey("key", now)
+	for name, s := range map[string]*miniredis.Miniredis{"primary": primary, "mirror": mirror} {
+		if got, _ := s.Get(key); got != "1" {
+			t.Errorf("%s count = %q, want 1", name, got)
+		}
+	}
+
+	// while counts are read from the primary only
+	mirror.Set(key, "5")
+	if curr, _, err := c.Get("key", now, now.Add(-time.Minute)); err != nil || curr != 1 {
+		t.Errorf("Get = %d, %v, want 1, nil", curr, err)
+	}
+
+	// a failing mirror is logged but doesn't fail the increment
+	working := c.mirror
+	c.mirror = failingClient(t)
+	defer func() { c.mirror = working }()
+	if err := c.Increment("key", now); err != nil {
+		t.Errorf("Increment with a failing mirror = %v, want nil", err)
+	}
+	c.drain.inflight.Wait()
+	if got, _ := primary.Get(key); got != "2" {
+		t.Errorf("primary count = %q, want 2", got)
+	}
+	if entries := logger.logged(); len(entries) != 1 || entries[0].msg != "redis mirror increment failed" {
+		t.Errorf("logged %v, want the mirror failure", entries)
+	}
+}
+
+func TestExpiryMultiplier(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		multiplier float64
+		want       time.Duration
+	}{
+		{0, DefaultExpiryMultiplier * time.Minute},
+		{5, 5 * time.Minute},
+		{2.5, 150 * time.Second},
+	} {
+		c, mr := newTestCounter(t, &Config{ExpiryMultiplier: tt.multiplier, Clock: fixedClock(start)})
+		if err := c.Increment("key", start); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+		if got := mr.TTL(c.limitCounterKey("key", start)); got != tt.want {
+			t.Errorf("ExpiryMultiplier %v: TTL = %v, want %v", tt.multiplier, got, tt.want)
+		}
+	}
+
+	for _, multiplier := range []float64{1, 1.99, -1} {
+		if _, err := NewRedisLimitCounter(&Config{ExpiryMultiplier: multiplier}); err == nil {
+			t.Errorf("ExpiryMultiplier %v was accepted", multiplier)
+		}
+	}
+}
+
+func TestExpiryJitter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	newCounter := func() *RedisLimitCounter {
+		c := newRedisLimitCounter(nil, &Config{ExpiryJitter: 10 * time.Second, Clock: fixedClock(start)})
+		c.randInt63n = rand.New(rand.NewSource(1)).Int63n
+		return c
+	}
+	c, same := newCounter(), newCounter()
+
+	base := (3 * time.Minute).Milliseconds()
+	varied := false
+	for i := 0; i < 1000; i++ {
+		got := c.expiryMillis(start, time.Minute)
+		ms, err := strconv.ParseInt(got, 10, 64)
+		if err != nil {
+			t.Fatalf("expiryMillis = %q: %v", got, err)
+		}
+		// jitter is only added, so the previous window stays readable
+		if ms < base || ms > base+(10*time.Second).Milliseconds() {
+			t.Fatalf("expiryMillis = %d, want within 10s past %d", ms, base)
+		}
+		varied = varied || ms != base
+		if again := same.expiryMillis(start, time.Minute); again != got {
+			t.Fatalf("call %d with the same seed = %s, want %s", i, again, got)
+		}
+	}
+	if !varied {
+		t.Error("expiryMillis never added any jitter")
+	}
+}
+
+func TestClusterModeKeysShareSlot(t *testing.T) {
+	c := newRedisLimitCounter(nil, &Config{ClusterMode: true})
+	c.Config(10, time.Minute)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	for _, key := range []string{"a", "127.0.0.1", "user:{42}"} {
+		curr, prev := c.limitCounterKey(key, now), c.limitCounterKey(key, now.Add(-time.Minute))
+		if curr == prev {
+			t.Fatalf("windows of %q share key %q", key, curr)
+		}
+		if keySlot(curr) != keySlot(prev) {
+			t.Errorf("windows of %q are in slots %d and %d", key, keySlot(curr), keySlot(prev))
+		}
+	}
+	if c.limitCounterKey("a", now) == c.limitCounterKey("b", now) {
+		t.Error("different keys share a counter")
+	}
+}
+
+func TestSentinelOptions(t *testing.T) {
+	opts, err := buildClientOption(&Config{
+		Addresses:         []string{"10.0.0.1:6379"},
+		SentinelAddresses: []string{"10.0.0.2:26379", "10.0.0.3:26379"},
+		SentinelMasterSet: "mymaster",
+	})
+	if err != nil {
+		t.Fatalf("buildClientOption: %v", err)
+	}
+	if opts.Sentinel.MasterSet != "mymaster" {
+		t.Errorf("master set = %q, want mymaster", opts.Sentinel.MasterSet)
+	}
+	if len(opts.InitAddress) != 2 || opts.InitAddress[0] != "10.0.0.2:26379" {
+		t.Errorf("init addresses = %v, want the sentinels", opts.InitAddress)
+	}
+
+	// Addresses is the sentinel list without SentinelAddresses
+	opts, err = buildClientOption(&Config{Addresses: []string{"10.0.0.1:26379"}, SentinelMasterSet: "mymaster"})
+	if err != nil {
+		t.Fatalf("buildClientOption: %v", err)
+	}
+	if len(opts.InitAddress) != 1 || opts.InitAddress[0] != "10.0.0.1:26379" {
+		t.Errorf("init addresses = %v, want Addresses", opts.InitAddress)
+	}
+
+	for name, cfg := range map[string]*Config{
+		"cluster":  {SentinelMasterSet: "mymaster", ClusterMode: true},
+		"replicas": {SentinelMasterSet: "mymaster", ReadAddresses: []string{"10.0.0.4:6379"}},
+		"mirror":   {SentinelMasterSet: "mymaster", MirrorAddresses: []string{"10.0.0.4:6379"}},
+		"address":  {SentinelMasterSet: "mymaster", SentinelAddresses: []string{"sentinel"}},
+	} {
+		if _, err := buildClientOption(cfg); err == nil {
+			t.Errorf("sentinel with %s was accepted", name)
+		}
+	}
+}
+
+func TestBuildClientOption(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		addresses []string
+		want      []string
+		shuffled  bool
+		wantErr   bool
+	}{
+		{"default", nil, []string{DefaultAddress}, false, false},
+		{"single", []string{"10.0.0.1:6379"}, []string{"10.0.0.1:6379"}, false, false},
+		{"trimmed", []string{" 10.0.0.1:6379\t"}, []string{"10.0.0.1:6379"}, false, false},
+		{"deduplicated", []string{"10.0.0.1:6379", " 10.0.0.1:6379", "10.0.0.2:6379"}, []string{"10.0.0.1:6379", "10.0.0.2:6379"}, true, false},
+		{"duplicates of one", []string{"10.0.0.1:6379", "10.0.0.1:6379"}, []string{"10.0.0.1:6379"}, false, false},
+		{"empty", []string{"10.0.0.1:6379", " "}, nil, false, true},
+		{"no port", []string{"10.0.0.1"}, nil, false, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := buildClientOption(&Config{Addresses: tt.addresses})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("buildClientOption accepted %q", tt.addresses)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildClientOption: %v", err)
+			}
+			if !reflect.DeepEqual(opts.InitAddress, tt.want) || opts.ShuffleInit != tt.shuffled {
+				t.Errorf("init addresses = %q, shuffled %v, want %q, shuffled %v", opts.InitAddress, opts.ShuffleInit, tt.want, tt.shuffled)
+			}
+		})
+	}
+}
+
+func TestPoolOptions(t *testing.T) {
+	opts, err := buildClientOption(&Config{PipelineMultiplex: 3, BlockingPoolSize: 50})
+	if err != nil {
+		t.Fatalf("buildClientOption: %v", err)
+	}
+	if opts.PipelineMultiplex != 3 || opts.BlockingPoolSize != 50 {
+		t.Errorf("PipelineMultiplex, BlockingPoolSize = %d, %d, want 3, 50", opts.PipelineMultiplex, opts.BlockingPoolSize)
+	}
+
+	// unset, they're left for rueidis to default
+	opts, err = buildClientOption(&Config{})
+	if err != nil {
+		t.Fatalf("buildClientOption: %v", err)
+	}
+	if opts.PipelineMultiplex != 0 || opts.BlockingPoolSize != 0 {
+		t.Errorf("default PipelineMultiplex, BlockingPoolSize = %d, %d, want 0, 0", opts.PipelineMultiplex, opts.BlockingPoolSize)
+	}
+}
+
+func TestTimeoutOptions(t *testing.T) {
+	opts, err := buildClientOption(&Config{DialTimeout: 2 * time.Second, WriteTimeout: 4 * time.Second})
+	if err != nil {
+		t.Fatalf("buildClientOption: %v", err)
+	}
+	if opts.Dialer.Timeout != 2*time.Second || opts.ConnWriteTimeout != 4*time.Second {
+		t.Errorf("dial, write timeouts = %v, %v, want 2s, 4s", opts.Dialer.Timeout, opts.ConnWriteTimeout)
+	}
+
+	opts, err = buildClientOption(&Config{})
+	if err != nil {
+		t.Fatalf("buildClientOption: %v", err)
+	}
+	if opts.Dialer.Timeout != 0 || opts.ConnWriteTimeout != 0 {
+		t.Errorf("default dial, write timeouts = %v, %v, want 0, 0", opts.Dialer.Timeout, opts.ConnWriteTimeout)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	opts, err := buildClientOption(&Config{KeepAlive: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("buildClientOption: %v", err)
+	}
+	if opts.Dialer.KeepAlive != 30*time.Second {
+		t.Errorf("keepalive = %v, want 30s", opts.Dialer.KeepAlive)
+	}
+
+	// unset, it's left for rueidis to default, and the write timeout that
+	// bounds its pings follows from it
+	opts, err = buildClientOption(&Config{})
+	if err != nil {
+		t.Fatalf("buildClientOption: %v", err)
+	}
+	if opts.Dialer.KeepAlive != 0 || opts.ConnWriteTimeout != 0 {
+		t.Errorf("default keepalive, write timeout = %v, %v, want 0, 0", opts.Dialer.KeepAlive, opts.ConnWriteTimeout)
+	}
+}
+
+func TestClientName(t *testing.T) {
+	for name, want := range map[string]string{"": "httprate-redis", "checkout-api": "checkout-api"} {
+		opts, err := buildClientOption(&Config{ClientName: name})
+		if err != nil {
+			t.Fatalf("buildClientOption: %v", err)
+		}
+		if opts.ClientName != want {
+			t.Errorf("ClientName %q: option = %q, want %q", name, opts.ClientName, want)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	now := time.Now().UTC()
+	c, _ := newTestCounter(t, &Config{Clock: fixedClock(now)})
+	currentWindow := now.Truncate(time.Minute)
+	previousWindow := currentWindow.Add(-time.Minute)
+
+	for _, window := range []time.Time{currentWindow, previousWindow} {
+		for _, key := range []string{"key", "other"} {
+			if err := c.Increment(key, window); err != nil {
+				t.Fatalf("Increment: %v", err)
+			}
+		}
+	}
+
+	if err := c.Reset("key"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if curr, prev, err := c.Get("key", currentWindow, previousWindow); err != nil || curr != 0 || prev != 0 {
+		t.Errorf("Get after Reset = %d, %d, %v, want 0, 0, nil", curr, prev, err)
+	}
+	if curr, prev, err := c.Get("other", currentWindow, previousWindow); err != nil || curr != 1 || prev != 1 {
+		t.Errorf("Get of another key after Reset = %d, %d, %v, want 1, 1, nil", curr, prev, err)
+	}
+
+	if err := NewRedisLimitCounterWithClient(nil).Reset("key"); err == nil {
+		t.Error("Reset before Config succeeded")
+	}
+}
+
+func TestGetCount(t *testing.T) {
+	now := time.Now().UTC()
+	c, _ := newTestCounter(t, &Config{Clock: fixedClock(now)})
+	currentWindow := now.Truncate(time.Minute)
+
+	if n, err := c.GetCount("key"); err != nil || n != 0 {
+		t.Errorf("GetCount of a new key = %d, %v, want 0, nil", n, err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := c.Increment("key", currentWindow); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+	// the previous window isn't counted
+	if err := c.Increment("key", currentWindow.Add(-time.Minute)); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if n, err := c.GetCount("key"); err != nil || n != 3 {
+		t.Errorf("GetCount = %d, %v, want 3, nil", n, err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	c, _ := newTestCounter(t, nil)
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	c.Close()
+	if err := c.Ping(ctx); err == nil {
+		t.Error("Ping on a closed client succeeded")
+	}
+}
+
+// cachingClient returns a mock client expecting Get reads from the
+// client-side cache, sending the TTLs they're cached for on ttls
+func cachingClient(t *testing.T, ttls chan<- time.Duration) *mock.Client {
+	t.Helper()
+	client := mock.NewClient(gomock.NewController(t))
+	client.EXPECT().DoMultiCache(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, multi ...rueidis.CacheableTTL) []rueidis.RedisResult {
+		results := make([]rueidis.RedisResult, len(multi))
+		for i, ct := range multi {
+			ttls <- ct.TTL
+			results[i] = mock.Result(mock.RedisInt64(int64(i + 1)))
+		}
+		return results
+	}).AnyTimes()
+	return client
+}
+
+func TestClientSideCache(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		ttl    time.Duration
+		window time.Duration
+		want   time.Duration
+	}{
+		{"default", 0, time.Minute, 100 * time.Millisecond},
+		{"configured", 250 * time.Millisecond, time.Minute, 250 * time.Millisecond},
+		{"capped at a tenth of the window", 5 * time.Second, 10 * time.Second, time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ttls := make(chan time.Duration, 2)
+			c := newRedisLimitCounter(cachingClient(t, ttls), &Config{ClientSideCache: true, ClientCacheTTL: tc.ttl})
+			c.Config(10, tc.window)
+			now := time.Now().UTC().Truncate(tc.window)
+
+			curr, prev, err := c.Get("key", now, now.Add(-tc.window))
+			if err != nil || curr != 1 || prev != 2 {
+				t.Fatalf("Get = %d, %d, %v, want 1, 2, nil", curr, prev, err)
+			}
+			for i := 0; i < 2; i++ {
+				if ttl := <-ttls; ttl != tc.want {
+					t.Errorf("read cached for %v, want %v", ttl, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestClientCacheTTLNeedsClientSideCache(t *testing.T) {
+	client := mock.NewClient(gomock.NewController(t))
+	client.EXPECT().DoMulti(gomock.Any(), gomock.Any()).Return([]rueidis.RedisResult{
+		mock.Result(mock.RedisNil()), mock.Result(mock.RedisNil()),
+	})
+	c := newRedisLimitCounter(client, &Config{ClientCacheTTL: time.Second})
+	c.Config(10, time.Minute)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	if _, _, err := c.Get("key", now, now.Add(-time.Minute)); err != nil {
+		t.Errorf("Get: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"zero", Config{}, ""},
+		{"addresses", Config{Addresses: []string{"10.0.0.1:6379", "[::1]:6379"}}, ""},
+		{"bad address", Config{Addresses: []string{"10.0.0.1:6379", "redis"}}, "address 1 "},
+		{"bad read address", Config{ReadAddresses: []string{"redis"}}, "read address 0 "},
+		{"bad mirror address", Config{MirrorAddresses: []string{"redis"}}, "mirror address 0 "},
+		{"bad sentinel address", Config{SentinelAddresses: []string{"redis"}}, "sentinel address 0 "},
+		{"negative db index", Config{DBIndex: -1}, "db index must not be negative"},
+		{"negative logical db", Config{LogicalDB: -1}, "logical db must not be negative"},
+		{"logical db and db index", Config{LogicalDB: 1, DBIndex: 2}, "can't both be set"},
+		{"cluster and db index", Config{ClusterMode: true, DBIndex: 1}, "redis cluster only supports db 0"},
+		{"cluster and db 0", Config{ClusterMode: true}, ""},
+		{"sentinel and cluster", Config{SentinelMasterSet: "mymaster", ClusterMode: true}, "sentinel and cluster"},
+		{"sentinel and replicas", Config{SentinelMasterSet: "mymaster", ReadAddresses: []string{"10.0.0.1:6379"}}, "sentinel and read"},
+		{"hash field and key func", Config{UseHashField: true, KeyFunc: func(key string, window time.Time) string { return key }}, "hash field and key func"},
+		{"expiry multiplier", Config{ExpiryMultiplier: 1.5}, "expiry multiplier must be at least 2"},
+		{"key format version", Config{KeyFormatVersion: 99}, "unknown key format version"},
+		{"expiry jitter", Config{ExpiryJitter: -time.Second}, "expiry jitter"},
+		{"max tracked keys", Config{MaxTrackedKeys: -1}, "max tracked keys"},
+		{"idempotency ttl", Config{IdempotencyTTL: -time.Second}, "idempotency ttl"},
+		{"max concurrent ops", Config{MaxConcurrentOps: -1}, "max concurrent ops"},
+		{"command timeout", Config{CommandTimeout: -time.Second}, "command timeout"},
+		{"coalesce window", Config{CoalesceWindow: -time.Second}, "coalesce window"},
+		{"max retries", Config{MaxRetries: -1}, "max retries"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), "invalid config: ") || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate = %v, want an invalid config error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterModeRejectsDBIndex(t *testing.T) {
+	// rejected before a connection is attempted, so no server is needed
+	if _, err := NewRedisLimitCounter(&Config{ClusterMode: true, DBIndex: 1}); err == nil || !strings.Contains(err.Error(), "db 0") {
+		t.Errorf("NewRedisLimitCounter = %v, want a cluster db index error", err)
+	}
+	if _, err := NewRedisLimitCounterContext(context.Background(), &Config{ClusterMode: true, DBIndex: 2}); err == nil {
+		t.Error("NewRedisLimitCounterContext accepted a cluster db index")
+	}
+}
+
+func TestAddressesPassThrough(t *testing.T) {
+	for _, addr := range []string{"10.0.0.1:6379", "[::1]:6379", "[2001:db8::1]:6380", "redis.internal:6379"} {
+		if err := validateAddress(addr); err != nil {
+			t.Errorf("validateAddress(%s) = %v", addr, err)
+		}
+		opts, err := buildClientOption(&Config{Addresses: []string{" " + addr + " "}})
+		if err != nil {
+			t.Fatalf("buildClientOption(%s): %v", addr, err)
+		}
+		if len(opts.InitAddress) != 1 || opts.InitAddress[0] != addr {
+			t.Errorf("init addresses of %s = %q, want it unchanged", addr, opts.InitAddress)
+		}
+	}
+
+	for _, addr := range []string{"", "redis", "::1:6379", "[::1]", "10.0.0.1"} {
+		if err := validateAddress(addr); err == nil {
+			t.Errorf("validateAddress(%q) accepted it", addr)
+		}
+	}
+}
+
+func TestConfigJSONYAML(t *testing.T) {
+	// every list is set, as YAML decodes an unset one as empty rather than nil
+	cfg := Config{
+		Addresses:         []string{"10.0.0.1:6379"},
+		ReadAddresses:     []string{"10.0.0.2:6379"},
+		MirrorAddresses:   []string{"10.0.0.3:6379"},
+		SentinelAddresses: []string{"10.0.0.4:26379"},
+		Password:          "secret",
+		DBIndex:           2,
+		Timeout:           500 * time.Millisecond,
+		UseHashField:      true,
+	}
+
+	for name, codec := range map[string]struct {
+		marshal   func(any) ([]byte, error)
+		unmarshal func([]byte, any) error
+	}{
+		"json": {json.Marshal, json.Unmarshal},
+		"yaml": {yaml.Marshal, yaml.Unmarshal},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := codec.marshal(cfg)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			fields := map[string]any{}
+			if err := codec.unmarshal(data, &fields); err != nil {
+				t.Fatalf("unmarshal into a map: %v", err)
+			}
+			for _, key := range []string{"addresses", "password", "db_index", "timeout", "use_hash_field"} {
+				if _, ok := fields[key]; !ok {
+					t.Errorf("%s has no %q key: %s", name, key, data)
+				}
+			}
+
+			var got Config
+			if err := codec.unmarshal(data, &got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(got, cfg) {
+				t.Errorf("round trip = %+v, want %+v", got, cfg)
+			}
+		})
+	}
+}
+
+func TestConfigTagsMatch(t *testing.T) {
+	typ := reflect.TypeOf(Config{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		toml := field.Tag.Get("toml")
+		if toml == "" {
+			t.Errorf("%s has no toml tag", field.Name)
+			continue
+		}
+		if json, yaml := field.Tag.Get("json"), field.Tag.Get("yaml"); json != toml || yaml != toml {
+			t.Errorf("%s tags toml %q, json %q, yaml %q, want them all the same", field.Name, toml, json, yaml)
+		}
+	}
+}
+
+func TestKeyTTL(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c, mr := newTestCounter(t, &Config{Clock: fixedClock(start.Add(20 * time.Second))})
+
+	if _, err := c.KeyTTL("key"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("KeyTTL of a new key = %v, want ErrKeyNotFound", err)
+	}
+	if err := c.Increment("key", start); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if ttl, err := c.KeyTTL("key"); err != nil || ttl != 3*time.Minute-20*time.Second {
+		t.Errorf("KeyTTL = %v, %v, want 2m40s, nil", ttl, err)
+	}
+
+	mr.Set(c.limitCounterKey("forever", start), "1")
+	if _, err := c.KeyTTL("forever"); !errors.Is(err, ErrNoExpiry) {
+		t.Errorf("KeyTTL of a key without an expiry = %v, want ErrNoExpiry", err)
+	}
+}
+
+func TestKeyTTLIgnoresUseHashField(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c, _ := newTestCounter(t, &Config{UseHashField: true, Clock: fixedClock(start)})
+
+	if err := c.Increment("key", start); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if _, err := c.KeyTTL("key"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("KeyTTL with UseHashField = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestFlushAll(t *testing.T) {
+	// the prefix's glob characters are matched literally
+	c, mr := newTestCounter(t, &Config{PrefixKey: "rl[1]*:"})
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	mr.Set("other", "1")
+	mr.Set("rl1:lookalike", "1")
+	// more keys than a single SCAN returns
+	for i := 0; i < 250; i++ {
+		if err := c.Increment(strconv.Itoa(i), now); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+
+	if err := c.FlushAll(context.Background()); err != nil {
+		t.Fatalf("FlushAll: %v", err)
+	}
+	if keys := mr.Keys(); len(keys) != 2 || keys[0] != "other" || keys[1] != "rl1:lookalike" {
+		t.Errorf("keys after FlushAll = %v, want other and rl1:lookalike", keys)
+	}
+	if n, err := c.GetCount("1"); err != nil || n != 0 {
+		t.Errorf("GetCount after FlushAll = %d, %v, want 0, nil", n, err)
+	}
+}
+
+func TestRejectEmptyKeys(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+
+	// by default empty keys share a counter like any other key
+	c, _ := newTestCounter(t, nil)
+	for i := 0; i < 2; i++ {
+		if err := c.Increment("", now); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+	if curr, _, err := c.Get("", now, prev); err != nil || curr != 2 {
+		t.Errorf("Get = %d, %v, want 2, nil", curr, err)
+	}
+
+	c, mr := newTestCounter(t, &Config{RejectEmptyKeys: true})
+	route := &routeCounter{counter: c, namespace: "login"}
+	route.Config(10, time.Minute)
+	for name, counter := range map[string]httprate.LimitCounter{"counter": c, "route": route} {
+		if err := counter.Increment("", now); !errors.Is(err, ErrEmptyKey) {
+			t.Errorf("%s: Increment = %v, want ErrEmptyKey", name, err)
+		}
+		if _, _, err := counter.Get("", now, prev); !errors.Is(err, ErrEmptyKey) {
+			t.Errorf("%s: Get = %v, want ErrEmptyKey", name, err)
+		}
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("keys written for an empty key: %v", keys)
+	}
+	if err := c.Increment("key", now); err != nil {
+		t.Errorf("Increment of a non-empty key = %v, want nil", err)
+	}
+}
+
+func TestCorruptKeys(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+
+	c, mr := newTestCounter(t, nil)
+	key := c.limitCounterKey("key", now)
+	mr.Set(key, "garbage")
+	_, _, err := c.Get("key", now, prev)
+	if !errors.Is(err, ErrCommand) {
+		t.Errorf("Get = %v, want ErrCommand", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), key) || !strings.Contains(err.Error(), `"garbage"`) {
+		t.Errorf("Get = %v, want the key and value named", err)
+	}
+	if got, _ := mr.Get(key); got != "garbage" {
+		t.Errorf("corrupt value = %q, want it left alone", got)
+	}
+
+	logger := &testLogger{}
+	c, mr = newTestCounter(t, &Config{RecoverCorruptKeys: true, Logger: logger})
+	mr.Set(key, "garbage")
+	mr.Set(c.limitCounterKey("key", prev), "3")
+	if curr, prevCount, err := c.Get("key", now, prev); err != nil || curr != 0 || prevCount != 3 {
+		t.Errorf("Get = %d, %d, %v, want 0, 3, nil", curr, prevCount, err)
+	}
+	if mr.Exists(key) {
+		t.Error("corrupt key wasn't deleted")
+	}
+	if entries := logger.logged(); len(entries) != 1 || entries[0].msg != "redis deleted corrupt counter" {
+		t.Errorf("logged %v, want the deletion", entries)
+	}
+
+	// counting starts over from zero
+	if err := c.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if curr, _, err := c.Get("key", now, prev); err != nil || curr != 1 {
+		t.Errorf("Get after Increment = %d, %v, want 1, nil", curr, err)
+	}
+}
+
+func TestCorruptKeysHashField(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	c, mr := newTestCounter(t, &Config{UseHashField: true, RecoverCorruptKeys: true})
+	key, field := c.counterKey("key", now, time.Minute)
+	mr.HSet(key, field, "garbage")
+	mr.HSet(key, "other", "2")
+
+	if curr, _, err := c.Get("key", now, now.Add(-time.Minute)); err != nil || curr != 0 {
+		t.Errorf("Get = %d, %v, want 0, nil", curr, err)
+	}
+	// only the corrupt field is deleted
+	if got := mr.HGet(key, field); got != "" {
+		t.Errorf("corrupt field = %q, want it deleted", got)
+	}
+	if got := mr.HGet(key, "other"); got != "2" {
+		t.Errorf("other field = %q, want 2", got)
+	}
+}
+
+func TestLogicalDB(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+
+	for _, clusterMode := range []bool{true, false} {
+		mr := miniredis.RunT(t)
+		counters := make([]*RedisLimitCounter, 3)
+		for db := range counters {
+			c, err := NewRedisLimitCounter(&Config{Addresses: []string{mr.Addr()}, ClusterMode: clusterMode, LogicalDB: db})
+			if err != nil {
+				t.Fatalf("NewRedisLimitCounter: %v", err)
+			}
+			defer c.Close()
+			c.Config(10, time.Minute)
+			for i := 0; i <= db; i++ {
+				if err := c.Increment("key", now); err != nil {
+					t.Fatalf("Increment: %v", err)
+				}
+			}
+			counters[db] = c
+		}
+
+		// each logical db only sees its own increments
+		for db, c := range counters {
+			if curr, _, err := c.Get("key", now, prev); err != nil || curr != db+1 {
+				t.Errorf("cluster mode %v: db %d Get = %d, %v, want %d, nil", clusterMode, db, curr, err, db+1)
+			}
+		}
+
+		// in cluster mode through a prefix in db 0, otherwise in the db itself
+		for db, c := range counters {
+			prefix, server := DefaultPrefix, mr.DB(db)
+			if clusterMode {
+				server = mr.DB(0)
+				if db != 0 {
+					prefix = fmt.Sprintf("%sdb%d:", DefaultPrefix, db)
+				}
+			}
+			key := c.limitCounterKey("key", now)
+			if want := prefix + strings.TrimPrefix(counters[0].limitCounterKey("key", now), DefaultPrefix); key != want {
+				t.Errorf("cluster mode %v: db %d key %s, want %s", clusterMode, db, key, want)
+			}
+			if !server.Exists(key) {
+				t.Errorf("cluster mode %v: db %d counter %s not found", clusterMode, db, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package httprateredis
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIncrementBy(t *testing.T) {
+	c, _ := newTestCounter(t, nil)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	if err := c.IncrementBy("key", now, 5); err != nil {
+		t.Fatalf("IncrementBy: %v", err)
+	}
+	if err := c.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	curr, _, err := c.Get("key", now, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if curr != 6 {
+		t.Errorf("count = %d, want 6", curr)
+	}
+
+	for _, n := range []int64{0, -1} {
+		if err := c.IncrementBy("key", now, n); err == nil {
+			t.Errorf("IncrementBy(%d) succeeded", n)
+		}
+	}
+	if curr, _, _ := c.Get("key", now, now.Add(-time.Minute)); curr != 6 {
+		t.Errorf("count after rejected increments = %d, want 6", curr)
+	}
+}
+
+func TestIncrementMultiGetMulti(t *testing.T) {
+	c, _ := newTestCounter(t, nil)
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+	keys := []string{"a", "b", "c"}
+
+	if err := c.IncrementMulti(keys, now); err != nil {
+		t.Fatalf("IncrementMulti: %v", err)
+	}
+	if err := c.IncrementMulti(keys[1:], now); err != nil {
+		t.Fatalf("IncrementMulti: %v", err)
+	}
+	if err := c.IncrementMulti(keys[2:], prev); err != nil {
+		t.Fatalf("IncrementMulti: %v", err)
+	}
+
+	curr, prevCounts, err := c.GetMulti(keys, now, prev)
+	if err != nil {
+		t.Fatalf("GetMulti: %v", err)
+	}
+	for i, key := range keys {
+		if want := []int{1, 2, 2}[i]; curr[i] != want {
+			t.Errorf("current count of %s = %d, want %d", key, curr[i], want)
+		}
+		if want := []int{0, 0, 1}[i]; prevCounts[i] != want {
+			t.Errorf("previous count of %s = %d, want %d", key, prevCounts[i], want)
+		}
+		// each agrees with a single Get
+		if c1, p1, _ := c.Get(key, now, prev); c1 != curr[i] || p1 != prevCounts[i] {
+			t.Errorf("Get of %s = %d, %d, GetMulti %d, %d", key, c1, p1, curr[i], prevCounts[i])
+		}
+	}
+}
+
+func TestIncrementAndGet(t *testing.T) {
+	// the script touches both window keys, which rueidis sends to miniredis
+	// as a cluster, so they must share a slot
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c, mr := newTestCounter(t, &Config{ClusterMode: true, Clock: fixedClock(start)})
+	prev := start.Add(-time.Minute)
+
+	if err := c.IncrementBy("key", prev, 4); err != nil {
+		t.Fatalf("IncrementBy: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		curr, prevCount, err := c.IncrementAndGet("key", start, prev)
+		if err != nil || curr != i || prevCount != 4 {
+			t.Errorf("IncrementAndGet %d = %d, %d, %v, want %d, 4, nil", i, curr, prevCount, err, i)
+		}
+	}
+
+	if curr, prevCount, _ := c.Get("key", start, prev); curr != 3 || prevCount != 4 {
+		t.Errorf("Get = %d, %d, want 3, 4", curr, prevCount)
+	}
+	if got := mr.TTL(c.limitCounterKey("key", start)); got != 3*time.Minute {
+		t.Errorf("TTL = %v, want 3m", got)
+	}
+}
+
+func TestIncrementAndGetNotConfigured(t *testing.T) {
+	c := newRedisLimitCounter(nil, &Config{})
+	now := time.Now()
+	if _, _, err := c.IncrementAndGet("key", now, now.Add(-time.Minute)); err == nil {
+		t.Error("IncrementAndGet on an unconfigured counter succeeded")
+	}
+}
+
+func TestIncrementAndGetCrossSlot(t *testing.T) {
+	// without ClusterMode the windows are in different slots, which rueidis
+	// would panic on rather than send
+	c, mr := newTestCounter(t, nil)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	if _, _, err := c.IncrementAndGet("key", now, now.Add(-time.Minute)); !errors.Is(err, ErrCrossSlot) {
+		t.Errorf("IncrementAndGet = %v, want ErrCrossSlot", err)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("keys written: %v", keys)
+	}
+}
+
+func TestIncrementIdempotent(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	// the counter and idempotency keys are set by one script, so must
+	// share a slot
+	c, mr := newTestCounter(t, &Config{ClusterMode: true, IdempotencyTTL: time.Minute, Clock: fixedClock(start)})
+	prev := start.Add(-time.Minute)
+
+	for i, want := range []bool{true, false, false} {
+		if ok, err := c.IncrementIdempotent("key", "request-1", start); err != nil || ok != want {
+			t.Errorf("IncrementIdempotent %d = %v, %v, want %v, nil", i, ok, err, want)
+		}
+	}
+	if ok, err := c.IncrementIdempotent("key", "request-2", start); err != nil || !ok {
+		t.Errorf("IncrementIdempotent of another request = %v, %v, want true, nil", ok, err)
+	}
+	if curr, _, _ := c.Get("key", start, prev); curr != 2 {
+		t.Errorf("count = %d, want 2", curr)
+	}
+
+	// the idempotency key is forgotten after IdempotencyTTL
+	mr.FastForward(time.Minute)
+	if ok, err := c.IncrementIdempotent("key", "request-1", start); err != nil || !ok {
+		t.Errorf("IncrementIdempotent after the TTL = %v, %v, want true, nil", ok, err)
+	}
+	if curr, _, _ := c.Get("key", start, prev); curr != 3 {
+		t.Errorf("count = %d, want 3", curr)
+	}
+}
+
+func TestIncrementIdempotentWithoutClusterMode(t *testing.T) {
+	c, _ := newTestCounter(t, &Config{IdempotencyTTL: time.Minute})
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	for i, want := range []bool{true, false} {
+		if ok, err := c.IncrementIdempotent("key", "request-1", now); err != nil || ok != want {
+			t.Errorf("IncrementIdempotent %d = %v, %v, want %v, nil", i, ok, err, want)
+		}
+	}
+	if curr, _, _ := c.Get("key", now, now.Add(-time.Minute)); curr != 1 {
+		t.Errorf("count = %d, want 1", curr)
+	}
+}
@@ -0,0 +1,184 @@
+package httprateredis_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	httprateredis "github.com/Keanu73/httprate-redis"
+	"github.com/Keanu73/httprate-redis/redistest"
+	"github.com/go-chi/httprate"
+)
+
+// startCounter starts a Redis container with redistest and returns a counter
+// connected to it, configured with a limit of 10 per minute
+func startCounter(t *testing.T, configure func(cfg *httprateredis.Config)) *httprateredis.RedisLimitCounter {
+	t.Helper()
+
+	cfg, cleanup := redistest.StartTestRedis(t)
+	t.Cleanup(cleanup)
+	if configure != nil {
+		configure(cfg)
+	}
+
+	c, err := httprateredis.NewRedisLimitCounter(cfg)
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounter: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	c.Config(10, time.Minute)
+	return c
+}
+
+// serverMajorVersion returns the major version of the Redis c connects to
+func serverMajorVersion(t *testing.T, c *httprateredis.RedisLimitCounter) int {
+	t.Helper()
+
+	client := c.Client()
+	info, err := client.Do(context.Background(), client.B().Info().Section("server").Build()).ToString()
+	if err != nil {
+		t.Fatalf("INFO server: %v", err)
+	}
+	for _, line := range strings.Split(info, "\n") {
+		if version, ok := strings.CutPrefix(strings.TrimSpace(line), "redis_version:"); ok {
+			major, _, _ := strings.Cut(version, ".")
+			n, err := strconv.Atoi(major)
+			if err != nil {
+				t.Fatalf("unexpected redis_version %q", version)
+			}
+			return n
+		}
+	}
+	t.Fatal("INFO server has no redis_version")
+	return 0
+}
+
+func TestIntegrationUseFunctions(t *testing.T) {
+	c := startCounter(t, func(cfg *httprateredis.Config) { cfg.UseFunctions = true })
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	client := c.Client()
+	libraries, err := client.Do(context.Background(), client.B().FunctionList().Libraryname("httprate").Build()).ToArray()
+	if major := serverMajorVersion(t, c); major >= 7 {
+		if err != nil || len(libraries) != 1 {
+			t.Fatalf("FUNCTION LIST on Redis %d = %d libraries, %v, want the httprate library", major, len(libraries), err)
+		}
+	} else if err == nil {
+		t.Fatalf("FUNCTION LIST succeeded on Redis %d", major)
+	}
+
+	// increments use FCALL on Redis 7 and EVALSHA before it
+	for i := 0; i < 3; i++ {
+		if err := c.Increment("key", now); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+	curr, _, err := c.Get("key", now, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if curr != 3 {
+		t.Errorf("current count = %d, want 3", curr)
+	}
+}
+
+func TestIntegrationTopKeys(t *testing.T) {
+	c := startCounter(t, nil)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	for i, key := range []string{"a", "b", "c"} {
+		if err := c.IncrementBy(key, now, int64(i+1)); err != nil {
+			t.Fatalf("IncrementBy(%q): %v", key, err)
+		}
+	}
+
+	top, err := c.TopKeys(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("TopKeys: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, kc := range top {
+		if seen[kc.RedisKey] {
+			t.Errorf("TopKeys lists %s twice", kc.RedisKey)
+		}
+		seen[kc.RedisKey] = true
+	}
+	if len(top) != 3 || top[0].Count != 3 || top[2].Count != 1 {
+		t.Errorf("TopKeys = %v, want counts 3, 2, 1", top)
+	}
+}
+
+func TestIntegrationIncrementAndGet(t *testing.T) {
+	c := startCounter(t, nil)
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+
+	if err := c.IncrementBy("key", prev, 4); err != nil {
+		t.Fatalf("IncrementBy: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := c.Increment("key", now); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+
+	curr, prevCount, err := c.Get("key", now, prev)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if curr != 3 || prevCount != 4 {
+		t.Errorf("Get = %d, %d, want 3, 4", curr, prevCount)
+	}
+
+	ttl, err := c.KeyTTL("key")
+	if err != nil {
+		t.Fatalf("KeyTTL: %v", err)
+	}
+	if ttl <= 2*time.Minute || ttl > 3*time.Minute {
+		t.Errorf("KeyTTL = %v, want between 2m and 3m", ttl)
+	}
+}
+
+func TestIntegrationLimit(t *testing.T) {
+	c := startCounter(t, nil)
+	limiter := httprate.Limit(2, time.Minute, httprate.WithLimitCounter(c))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var codes []int
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		limiter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("response codes = %v, want 200, 200, 429", codes)
+	}
+}
+
+func TestIntegrationFlushAll(t *testing.T) {
+	c := startCounter(t, nil)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	client := c.Client()
+	if err := client.Do(ctx, client.B().Set().Key("other").Value("1").Build()).Error(); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	if err := c.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+
+	if err := c.FlushAll(ctx); err != nil {
+		t.Fatalf("FlushAll: %v", err)
+	}
+	if n, err := c.GetCount("key"); err != nil || n != 0 {
+		t.Errorf("GetCount after FlushAll = %d, %v, want 0", n, err)
+	}
+	if n, err := client.Do(ctx, client.B().Exists().Key("other").Build()).AsInt64(); err != nil || n != 1 {
+		t.Errorf("EXISTS other after FlushAll = %d, %v, want 1", n, err)
+	}
+}
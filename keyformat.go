@@ -0,0 +1,45 @@
+package httprateredis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Key format versions, see Config.KeyFormatVersion.
+const (
+	// KeyFormatLegacy derives keys with httprate.LimitCounterKey, so they
+	// change if httprate changes its hashing
+	KeyFormatLegacy = 0
+	// KeyFormatV1 derives keys with hashing pinned by this package, and
+	// embeds "v1:" after the prefix
+	KeyFormatV1 = 1
+)
+
+// windowKeyHash hashes key and window like httprate.LimitCounterKey did as of
+// httprate v0.7.0, pinned so that KeyFormatV1 keys never change
+func windowKeyHash(key string, window time.Time) uint64 {
+	var num [20]byte
+	h := xxhash.New()
+	h.WriteString(key)
+	h.Write(strconv.AppendInt(num[:0], window.Unix(), 10))
+	return h.Sum64()
+}
+
+// KeyFormatVersion returns the key format version of a Redis key written by
+// the counter, and false if the key isn't under the counter's prefix.
+func (c *RedisLimitCounter) KeyFormatVersion(redisKey string) (int, bool) {
+	rest, ok := strings.CutPrefix(redisKey, c.prefix)
+	if !ok {
+		return 0, false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(rest, "v%d:", &version); err != nil {
+		return KeyFormatLegacy, true
+	}
+	return version, true
+}
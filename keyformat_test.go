@@ -0,0 +1,189 @@
+package httprateredis
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-chi/httprate"
+)
+
+// sprintfCounterKey is limitCounterKey as it was built with fmt.Sprintf
+func sprintfCounterKey(c *RedisLimitCounter, key string, window time.Time) string {
+	prefix := c.prefix
+	if c.keyVersion == KeyFormatV1 {
+		prefix += "v1:"
+	}
+	if c.cluster {
+		return fmt.Sprintf("%s{%d}:%d", prefix, xxhash.Sum64String(key), window.Unix())
+	}
+	if c.keyVersion == KeyFormatV1 {
+		return fmt.Sprintf("%s%d", prefix, windowKeyHash(key, window))
+	}
+	return fmt.Sprintf("%s%d", prefix, httprate.LimitCounterKey(key, window))
+}
+
+func TestLimitCounterKeyMatchesSprintf(t *testing.T) {
+	windows := []time.Time{time.Unix(0, 0), time.Unix(1700000000, 0), time.Unix(-60, 0)}
+	keys := []string{"", "127.0.0.1", "user:42", "\x00ctx:1"}
+
+	for _, cluster := range []bool{false, true} {
+		for _, version := range []int{KeyFormatLegacy, KeyFormatV1} {
+			c := &RedisLimitCounter{prefix: DefaultPrefix, cluster: cluster, keyVersion: version}
+			for _, key := range keys {
+				for _, window := range windows {
+					got, want := c.limitCounterKey(key, window), sprintfCounterKey(c, key, window)
+					if got != want {
+						t.Errorf("cluster %v, version %d: limitCounterKey(%q, %d) = %q, want %q", cluster, version, key, window.Unix(), got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestWindowKeyHashMatchesHttprate(t *testing.T) {
+	window := time.Unix(1700000000, 0)
+	if got, want := windowKeyHash("key", window), httprate.LimitCounterKey("key", window); got != want {
+		t.Errorf("windowKeyHash = %d, httprate.LimitCounterKey = %d", got, want)
+	}
+}
+
+func BenchmarkLimitCounterKey(b *testing.B) {
+	window := time.Unix(1700000000, 0)
+	for _, bc := range []struct {
+		name string
+		c    *RedisLimitCounter
+	}{
+		{"legacy", &RedisLimitCounter{prefix: DefaultPrefix}},
+		{"v1", &RedisLimitCounter{prefix: DefaultPrefix, keyVersion: KeyFormatV1}},
+		{"cluster", &RedisLimitCounter{prefix: DefaultPrefix, cluster: true}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bc.c.limitCounterKey("127.0.0.1", window)
+			}
+		})
+		b.Run(bc.name+"/sprintf", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sprintfCounterKey(bc.c, "127.0.0.1", window)
+			}
+		})
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+	var seen []string
+	c := newRedisLimitCounter(nil, &Config{
+		HashKeys: true,
+		KeyFunc: func(key string, window time.Time) string {
+			seen = append(seen, key)
+			return key
+		},
+	})
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	long := strings.Repeat("x", 10000)
+	for _, key := range []string{long, long, "", "short"} {
+		c.limitCounterKey(key, now)
+	}
+
+	for i, key := range seen {
+		if len(key) != 16 {
+			t.Errorf("key %d is %d bytes long, want 16", i, len(key))
+		}
+	}
+	if seen[0] != seen[1] {
+		t.Errorf("the same key hashed to %s and %s", seen[0], seen[1])
+	}
+	if seen[0] == seen[2] || seen[2] == seen[3] {
+		t.Errorf("different keys share the hash in %v", seen)
+	}
+
+	// the digest is fixed, so keys survive restarts and upgrades
+	if seen[3] != "a0f4ea7d91495df9" {
+		t.Errorf("short hashed to %s, want a0f4ea7d91495df9", seen[3])
+	}
+}
+
+func TestKeyFunc(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c, mr := newTestCounter(t, &Config{
+		Clock: fixedClock(start),
+		KeyFunc: func(baseKey string, window time.Time) string {
+			return fmt.Sprintf("custom:%s:%d", baseKey, window.Unix())
+		},
+	})
+	prev := start.Add(-time.Minute)
+
+	if err := c.Increment("user-1", start); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if err := c.IncrementBy("user-1", prev, 2); err != nil {
+		t.Fatalf("IncrementBy: %v", err)
+	}
+
+	currKey, prevKey := fmt.Sprintf("custom:user-1:%d", start.Unix()), fmt.Sprintf("custom:user-1:%d", prev.Unix())
+	if keys := mr.Keys(); len(keys) != 2 || !mr.Exists(currKey) || !mr.Exists(prevKey) {
+		t.Fatalf("keys = %v, want %s and %s", keys, currKey, prevKey)
+	}
+	if got := mr.TTL(currKey); got != 3*time.Minute {
+		t.Errorf("TTL of %s = %v, want 3m", currKey, got)
+	}
+	if curr, prevCount, err := c.Get("user-1", start, prev); err != nil || curr != 1 || prevCount != 2 {
+		t.Errorf("Get = %d, %d, %v, want 1, 2, nil", curr, prevCount, err)
+	}
+}
+
+func TestKeyFormatVersions(t *testing.T) {
+	window := time.Unix(1700000000, 0)
+	for _, cluster := range []bool{false, true} {
+		legacy := &RedisLimitCounter{prefix: DefaultPrefix, cluster: cluster}
+		v1 := &RedisLimitCounter{prefix: DefaultPrefix, cluster: cluster, keyVersion: KeyFormatV1}
+
+		seen := map[string]int{}
+		for _, c := range []*RedisLimitCounter{legacy, v1} {
+			for _, key := range []string{"", "127.0.0.1", "user:42"} {
+				redisKey := c.limitCounterKey(key, window)
+				if version, ok := seen[redisKey]; ok {
+					t.Errorf("cluster %v: %s is a key of versions %d and %d", cluster, redisKey, version, c.keyVersion)
+				}
+				seen[redisKey] = c.keyVersion
+
+				// either counter recovers the version a key was written with
+				for _, reader := range []*RedisLimitCounter{legacy, v1} {
+					if version, ok := reader.KeyFormatVersion(redisKey); !ok || version != c.keyVersion {
+						t.Errorf("cluster %v: KeyFormatVersion(%s) = %d, %v, want %d, true", cluster, redisKey, version, ok, c.keyVersion)
+					}
+				}
+			}
+		}
+	}
+
+	if _, ok := (&RedisLimitCounter{prefix: DefaultPrefix}).KeyFormatVersion("other:v1:1"); ok {
+		t.Error("KeyFormatVersion recognised a key under another prefix")
+	}
+}
+
+func TestKeyFormatVersionsCountSeparately(t *testing.T) {
+	legacy, mr := newTestCounter(t, nil)
+	v1, err := NewRedisLimitCounter(&Config{Addresses: []string{mr.Addr()}, KeyFormatVersion: KeyFormatV1})
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounter: %v", err)
+	}
+	defer v1.Close()
+	v1.Config(10, time.Minute)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	if err := legacy.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	// switching versions starts the count from zero
+	if curr, _, err := v1.Get("key", now, now.Add(-time.Minute)); err != nil || curr != 0 {
+		t.Errorf("v1 count after a legacy increment = %d, %v, want 0, nil", curr, err)
+	}
+}
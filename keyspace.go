@@ -0,0 +1,87 @@
+package httprateredis
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrTooManyKeys is reported to Logger and OnError when the keyspace guard
+// finds more keys than MaxTrackedKeys.
+var ErrTooManyKeys = errors.New("redis keyspace exceeds max tracked keys")
+
+const defaultKeyspaceCheckInterval = time.Minute
+
+// keyspaceGuard periodically counts the keys in Redis, so that runaway key
+// growth, e.g. from unvalidated keys, is reported before memory runs out
+type keyspaceGuard struct {
+	max      int64
+	interval time.Duration
+
+	mu       sync.Mutex
+	checking bool
+	next     time.Time
+}
+
+// due reports whether a check should start at now, and marks it started
+func (g *keyspaceGuard) due(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.checking || now.Before(g.next) {
+		return false
+	}
+	g.checking = true
+	g.next = now.Add(g.interval)
+	return true
+}
+
+// done marks a check started by due as finished
+func (g *keyspaceGuard) done() {
+	g.mu.Lock()
+	g.checking = false
+	g.mu.Unlock()
+}
+
+// checkKeyspace starts a background count of the keys in Redis if one is
+// due. The count uses DBSIZE, so it includes keys outside the prefix; it's a
+// best-effort safety valve rather than an exact limit.
+func (c *RedisLimitCounter) checkKeyspace() {
+	if c.keyspace == nil || !c.keyspace.due(c.clock()) {
+		return
+	}
+
+	go func() {
+		defer c.keyspace.done()
+
+		ctx, cancel := c.opContext(c.ctx)
+		defer cancel()
+
+		// replicas hold copies of their master's keys
+		nodes, err := masterNodes(ctx, c.client)
+		if err != nil {
+			return
+		}
+
+		var keys int64
+		for _, node := range nodes {
+			n, err := node.Do(ctx, node.B().Dbsize().Build()).AsInt64()
+			if err != nil {
+				// the next increment's failure is reported instead
+				return
+			}
+			keys += n
+		}
+		if keys <= c.keyspace.max {
+			return
+		}
+
+		err = fmt.Errorf("%w: %d keys, max %d", ErrTooManyKeys, keys, c.keyspace.max)
+		if c.logger != nil {
+			c.logger.Error("redis keyspace guard tripped", "keys", keys, "error", err)
+		}
+		if c.onError != nil {
+			c.onError(err)
+		}
+	}()
+}
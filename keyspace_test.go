@@ -0,0 +1,67 @@
+package httprateredis
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeyspaceGuard(t *testing.T) {
+	errs := make(chan error, 1)
+	c, mr := newTestCounter(t, &Config{
+		MaxTrackedKeys: 2,
+		OnError:        func(err error) { errs <- err },
+	})
+	mr.Set("a", "1")
+	mr.Set("b", "1")
+
+	if err := c.Increment("key", time.Now().UTC().Truncate(time.Minute)); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrTooManyKeys) {
+			t.Errorf("OnError got %v, want ErrTooManyKeys", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the keyspace guard didn't report 3 keys over a max of 2")
+	}
+}
+
+func TestKeyspaceGuardUnderMax(t *testing.T) {
+	errs := make(chan error, 1)
+	c, _ := newTestCounter(t, &Config{
+		MaxTrackedKeys: 2,
+		OnError:        func(err error) { errs <- err },
+	})
+
+	if err := c.Increment("key", time.Now().UTC().Truncate(time.Minute)); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+
+	select {
+	case err := <-errs:
+		t.Errorf("OnError got %v under the max", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestKeyspaceGuardDue(t *testing.T) {
+	g := &keyspaceGuard{max: 1, interval: time.Minute}
+	now := time.Now()
+
+	if !g.due(now) {
+		t.Fatal("first check isn't due")
+	}
+	if g.due(now) {
+		t.Error("a check is due while one is running")
+	}
+	g.done()
+	if g.due(now.Add(time.Second)) {
+		t.Error("a check is due within the interval")
+	}
+	if !g.due(now.Add(time.Minute)) {
+		t.Error("a check isn't due after the interval")
+	}
+}
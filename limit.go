@@ -0,0 +1,110 @@
+package httprateredis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Remaining returns how many more requests key may make under requestLimit,
+// using the same sliding window weighting httprate enforces limits with.
+// It reports the stored counts in ShadowMode too.
+func (c *RedisLimitCounter) Remaining(key string, requestLimit int, currentWindow, previousWindow time.Time) (int, error) {
+	if c.windowLength <= 0 {
+		return 0, errors.New("redis get failed: counter is not configured")
+	}
+
+	curr, prev, err := c.countWindow(key, currentWindow, previousWindow, c.windowLength)
+	if err != nil {
+		return 0, err
+	}
+
+	used := int(math.Round(slidingRate(curr, prev, c.clock().Sub(currentWindow), c.windowLength)))
+	if used >= requestLimit {
+		return 0, nil
+	}
+	return requestLimit - used, nil
+}
+
+// AllowWeighted decides whether key may make another request under limit
+// and counts it if so, in a single script, so that concurrent callers can't
+// both be allowed past the limit. It returns the weighted count of key,
+// including the request if it was allowed. Both window keys must map to the
+// same slot, like for IncrementAndGet. In ShadowMode every request is
+// counted and allowed.
+func (c *RedisLimitCounter) AllowWeighted(key string, limit int, currentWindow, previousWindow time.Time) (bool, int, error) {
+	if c.windowLength <= 0 {
+		return false, 0, errors.New("redis allow failed: counter is not configured")
+	}
+	return c.allowWindow(key, limit, c.windowLength, currentWindow, previousWindow)
+}
+
+// Allow decides whether key may make another request under limit requests
+// per window and counts it if so, like AllowWeighted, for callers outside
+// of httprate's middleware such as gRPC interceptors or background jobs.
+func (c *RedisLimitCounter) Allow(key string, limit int, window time.Duration) (bool, error) {
+	if window <= 0 {
+		return false, fmt.Errorf("redis allow failed: window must be positive, got %v", window)
+	}
+
+	currentWindow := c.clock().UTC().Truncate(window)
+	allowed, _, err := c.allowWindow(key, limit, window, currentWindow, currentWindow.Add(-window))
+	return allowed, err
+}
+
+// allowWindow runs allowWeightedScript for windows of windowLength
+func (c *RedisLimitCounter) allowWindow(key string, limit int, windowLength time.Duration, currentWindow, previousWindow time.Time) (bool, int, error) {
+	elapsed := c.clock().Sub(currentWindow)
+	if elapsed < 0 {
+		elapsed = 0
+	} else if elapsed > windowLength {
+		elapsed = windowLength
+	}
+
+	keys := []string{c.windowKey(key, currentWindow, windowLength), c.windowKey(key, previousWindow, windowLength)}
+	if err := checkSlot(keys...); err != nil {
+		return false, 0, fmt.Errorf("redis allow failed: %w", err)
+	}
+
+	ctx, cancel := c.opContext(c.ctx)
+	defer cancel()
+
+	result, err := allowWeightedScript.Exec(ctx, c.client, keys,
+		[]string{
+			c.expiryMillis(currentWindow, windowLength),
+			strconv.Itoa(limit),
+			strconv.FormatInt(windowLength.Milliseconds(), 10),
+			strconv.FormatInt(elapsed.Milliseconds(), 10),
+			shadowArg(c.shadow),
+		},
+	).AsIntSlice()
+	if err != nil {
+		return false, 0, fmt.Errorf("redis allow failed: %w", classify(err))
+	}
+
+	if err := checkReplies(len(result), 2); err != nil {
+		return false, 0, fmt.Errorf("redis allow failed: %w", err)
+	}
+
+	allowed, used := result[0] == 1, int(result[1])
+	if c.shadow && !allowed {
+		// counted all the same, so used includes the request
+		c.observeWouldBlock(key, used-1, limit)
+		allowed = true
+	}
+	c.observeDecision(allowed)
+	return allowed, used, nil
+}
+
+// slidingRate returns the request rate httprate computes for a key, where
+// elapsed is the time since the current window started: the previous
+// window's count is weighted by how much of it still overlaps the sliding
+// window
+func slidingRate(curr, prev int, elapsed, windowLength time.Duration) float64 {
+	if windowLength <= 0 {
+		return float64(curr)
+	}
+	return float64(prev)*(float64(windowLength)-float64(elapsed))/float64(windowLength) + float64(curr)
+}
@@ -0,0 +1,166 @@
+package httprateredis
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRemainingAcrossWindowBoundary(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	c, _ := newTestCounter(t, &Config{Clock: func() time.Time { return now }})
+	prev := start.Add(-time.Minute)
+
+	if err := c.IncrementBy("key", prev, 8); err != nil {
+		t.Fatalf("IncrementBy: %v", err)
+	}
+	if err := c.IncrementBy("key", start, 2); err != nil {
+		t.Fatalf("IncrementBy: %v", err)
+	}
+
+	tests := []struct {
+		elapsed time.Duration
+		limit   int
+		want    int
+	}{
+		// the previous window still counts in full at the boundary
+		{0, 10, 0},
+		{0, 20, 10},
+		// a quarter of the way in, 8*0.75 + 2 are used
+		{15 * time.Second, 10, 2},
+		{45 * time.Second, 10, 6},
+	}
+	for _, tt := range tests {
+		now = start.Add(tt.elapsed)
+		got, err := c.Remaining("key", tt.limit, start, prev)
+		if err != nil {
+			t.Fatalf("Remaining: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Remaining(limit %d) %v into the window = %d, want %d", tt.limit, tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestRemainingNotConfigured(t *testing.T) {
+	c := NewRedisLimitCounterWithClient(nil)
+	if _, err := c.Remaining("key", 10, time.Now(), time.Now()); err == nil {
+		t.Error("Remaining before Config succeeded")
+	}
+}
+
+func TestRemainingShadowMode(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	hook := &shadowHook{}
+	c, _ := newTestCounter(t, &Config{Clock: fixedClock(start), ShadowMode: true, Metrics: hook})
+	if err := c.IncrementBy("key", start, 3); err != nil {
+		t.Fatalf("IncrementBy: %v", err)
+	}
+
+	// the stored counts are used against the limit asked about, and
+	// Remaining isn't a limit check to report
+	if n, err := c.Remaining("key", 10, start, start.Add(-time.Minute)); err != nil || n != 7 {
+		t.Errorf("Remaining = %d, %v, want 7, nil", n, err)
+	}
+	if n, err := c.Remaining("key", 2, start, start.Add(-time.Minute)); err != nil || n != 0 {
+		t.Errorf("Remaining over the limit = %d, %v, want 0, nil", n, err)
+	}
+	if len(hook.wouldBlocks) != 0 {
+		t.Errorf("ObserveWouldBlock got %v, want no calls", hook.wouldBlocks)
+	}
+}
+
+func TestAllowWeightedConcurrent(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	// both windows are read by one script, so must share a slot
+	c, _ := newTestCounter(t, &Config{ClusterMode: true, Clock: fixedClock(start.Add(30 * time.Second))})
+	prev := start.Add(-time.Minute)
+
+	// half way through the window, 8 previous requests weigh as 4
+	if err := c.IncrementBy("key", prev, 8); err != nil {
+		t.Fatalf("IncrementBy: %v", err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int64
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := c.AllowWeighted("key", 10, start, prev)
+			if err != nil {
+				t.Errorf("AllowWeighted: %v", err)
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != 6 {
+		t.Errorf("allowed %d concurrent requests, want 6", n)
+	}
+	if curr, _, _ := c.Get("key", start, prev); curr != 6 {
+		t.Errorf("count = %d, want only the 6 allowed requests", curr)
+	}
+	if ok, used, err := c.AllowWeighted("key", 10, start, prev); ok || used != 10 || err != nil {
+		t.Errorf("AllowWeighted at the limit = %v, %d, %v, want false, 10, nil", ok, used, err)
+	}
+}
+
+func TestAllowWeightedCrossSlot(t *testing.T) {
+	c, mr := newTestCounter(t, nil)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	if _, _, err := c.AllowWeighted("key", 10, now, now.Add(-time.Minute)); !errors.Is(err, ErrCrossSlot) {
+		t.Errorf("AllowWeighted = %v, want ErrCrossSlot", err)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("keys written: %v", keys)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	c, _ := newTestCounter(t, &Config{ClusterMode: true, Clock: func() time.Time { return now }})
+
+	for i := 0; i < 3; i++ {
+		if ok, err := c.Allow("job", 3, time.Second); err != nil || !ok {
+			t.Fatalf("Allow %d = %v, %v, want true, nil", i, ok, err)
+		}
+	}
+	if ok, err := c.Allow("job", 3, time.Second); err != nil || ok {
+		t.Errorf("Allow past the limit = %v, %v, want false, nil", ok, err)
+	}
+	// the limit is per key and per window length
+	if ok, err := c.Allow("other", 3, time.Second); err != nil || !ok {
+		t.Errorf("Allow of another key = %v, %v, want true, nil", ok, err)
+	}
+	if ok, err := c.Allow("job", 3, time.Minute); err != nil || !ok {
+		t.Errorf("Allow with another window = %v, %v, want true, nil", ok, err)
+	}
+
+	// two windows on, the old requests no longer weigh
+	now = start.Add(2 * time.Second)
+	if ok, err := c.Allow("job", 3, time.Second); err != nil || !ok {
+		t.Errorf("Allow two windows later = %v, %v, want true, nil", ok, err)
+	}
+
+	if _, err := c.Allow("job", 3, 0); err == nil {
+		t.Error("Allow with a zero window succeeded")
+	}
+}
+
+func TestAllowCrossSlot(t *testing.T) {
+	c, _ := newTestCounter(t, nil)
+	if _, err := c.Allow("job", 3, time.Second); !errors.Is(err, ErrCrossSlot) {
+		t.Errorf("Allow = %v, want ErrCrossSlot", err)
+	}
+}
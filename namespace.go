@@ -0,0 +1,130 @@
+package httprateredis
+
+import (
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+// WithRouteNamespace returns an httprate option that backs a limiter with
+// this counter, keeping its counts separate from limiters using other
+// namespaces. This lets limiters with different limits or windows share one
+// counter and connection:
+/*
+	r.With(httprate.Limit(10, time.Minute, counter.WithRouteNamespace("login"))).Post("/login", login)
+	r.With(httprate.Limit(100, time.Minute, counter.WithRouteNamespace("api"))).Get("/api", api)
+*/
+func (c *RedisLimitCounter) WithRouteNamespace(ns string) httprate.Option {
+	return httprate.WithLimitCounter(&routeCounter{
+		counter:   c,
+		namespace: ns,
+	})
+}
+
+// routeCounter namespaces the keys of a shared counter, and keeps its own
+// limit and window length so that limiters configuring the shared counter
+// don't override each other's key expiry or ShadowMode limit
+type routeCounter struct {
+	counter      *RedisLimitCounter
+	namespace    string
+	requestLimit int
+	windowLength time.Duration
+}
+
+var _ httprate.LimitCounter = &routeCounter{}
+
+func (r *routeCounter) Config(requestLimit int, windowLength time.Duration) {
+	r.requestLimit = requestLimit
+	r.windowLength = windowLength
+	// the shared counter may never be configured itself
+	r.counter.configureFallback(requestLimit, windowLength)
+}
+
+func (r *routeCounter) Increment(key string, currentWindow time.Time) error {
+	if err := r.counter.checkKey(key); err != nil {
+		return err
+	}
+	return r.counter.incrementWindow(r.key(key), currentWindow, r.windowLength, 1)
+}
+
+func (r *routeCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	if err := r.counter.checkKey(key); err != nil {
+		return 0, 0, err
+	}
+	return r.counter.getWindow(r.key(key), currentWindow, previousWindow, r.requestLimit, r.windowLength)
+}
+
+// key returns key within the namespace, the NUL separator can't be mistaken
+// for part of a namespace
+func (r *routeCounter) key(key string) string {
+	return r.namespace + "\x00" + key
+}
+
+// ForTenant returns a counter that shares this counter's connection and
+// settings but keeps its keys under a per-tenant prefix, so that a tenant's
+// rate-limit data can be inspected or deleted on its own. Redis logical DBs
+// can't be used for this, as SELECT changes the state of a whole connection
+// and rueidis shares its connections between concurrent callers.
+//
+// With a KeyFunc, the tenant is instead passed to it as part of the base key.
+// Tenant counters don't own the connection, closing one is a no-op, and
+// they share the parent's Shutdown, which waits for their in-flight calls.
+func (c *RedisLimitCounter) ForTenant(tenant string) *RedisLimitCounter {
+	tc := &RedisLimitCounter{
+		client:          c.client,
+		reader:          c.reader,
+		mirror:          c.mirror,
+		ctx:             c.ctx,
+		clock:           c.clock,
+		prefix:          c.prefix + tenant + ":",
+		cluster:         c.cluster,
+		hashKeys:        c.hashKeys,
+		keyVersion:      c.keyVersion,
+		hashField:       c.hashField,
+		functions:       c.functions,
+		expiry:          c.expiry,
+		jitter:          c.jitter,
+		randInt63n:      c.randInt63n,
+		noTTL:           c.noTTL,
+		timeout:         c.timeout,
+		cmdTimeout:      c.cmdTimeout,
+		cacheTTL:        c.cacheTTL,
+		idemTTL:         c.idemTTL,
+		maxRetries:      c.maxRetries,
+		retryBackoff:    c.retryBackoff,
+		requestLimit:    c.requestLimit,
+		windowLength:    c.windowLength,
+		metrics:         c.metrics,
+		tracer:          c.tracer,
+		logger:          c.logger,
+		onError:         c.onError,
+		keyFunc:         c.keyFunc,
+		reqContexts:     c.reqContexts,
+		drain:           c.drain,
+		fallbackToLocal: c.fallbackToLocal,
+		breaker:         c.breaker,
+		failMode:        c.failMode,
+		shadow:          c.shadow,
+		rejectEmptyKeys: c.rejectEmptyKeys,
+		recoverCorrupt:  c.recoverCorrupt,
+		strictExisting:  c.strictExisting,
+		keyspace:        c.keyspace,
+		sem:             c.sem,
+		overloadMode:    c.overloadMode,
+	}
+	if keyFunc := c.keyFunc; keyFunc != nil {
+		tc.keyFunc = func(baseKey string, window time.Time) string {
+			return keyFunc(tenant+"\x00"+baseKey, window)
+		}
+	}
+	if c.coalescer != nil {
+		tc.coalescer = &coalescer{
+			window:  c.coalescer.window,
+			pending: make(map[coalesceKey]*coalesced),
+		}
+	}
+	if tc.fallbackToLocal && tc.windowLength > 0 {
+		tc.Config(tc.requestLimit, tc.windowLength)
+	}
+	return tc
+}
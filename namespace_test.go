@@ -0,0 +1,120 @@
+package httprateredis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/httprate"
+)
+
+// serve sends a request through h and returns the response status
+func serve(h http.Handler) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Code
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestRouteNamespaceIsolation(t *testing.T) {
+	c, _ := newTestCounter(t, nil)
+
+	login := httprate.Limit(2, time.Minute, c.WithRouteNamespace("login"))(okHandler)
+	api := httprate.Limit(5, time.Minute, c.WithRouteNamespace("api"))(okHandler)
+
+	for i := 0; i < 2; i++ {
+		if code := serve(login); code != http.StatusOK {
+			t.Fatalf("login request %d = %d, want 200", i, code)
+		}
+	}
+	if code := serve(login); code != http.StatusTooManyRequests {
+		t.Errorf("third login request = %d, want 429", code)
+	}
+	if code := serve(api); code != http.StatusOK {
+		t.Errorf("api request after login was limited = %d, want 200", code)
+	}
+}
+
+func TestRouteNamespaceFallbackToLocal(t *testing.T) {
+	mr := miniredis.RunT(t)
+	// the shared counter is only configured through its namespaces
+	c, err := NewRedisLimitCounter(&Config{Addresses: []string{mr.Addr()}, FallbackToLocal: true, Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounter: %v", err)
+	}
+	defer c.Close()
+	mr.Close()
+
+	login := httprate.Limit(2, time.Minute, c.WithRouteNamespace("login"))(okHandler)
+	api := httprate.Limit(2, time.Minute, c.WithRouteNamespace("api"))(okHandler)
+
+	// with Redis down, both namespaces are counted in memory, separately
+	for i := 0; i < 2; i++ {
+		if code := serve(login); code != http.StatusOK {
+			t.Fatalf("login request %d = %d, want 200", i, code)
+		}
+	}
+	if code := serve(login); code != http.StatusTooManyRequests {
+		t.Errorf("third login request = %d, want 429", code)
+	}
+	if code := serve(api); code != http.StatusOK {
+		t.Errorf("api request = %d, want 200", code)
+	}
+}
+
+func TestRouteNamespaceFallbackWindow(t *testing.T) {
+	c, _ := newTestCounter(t, &Config{FallbackToLocal: true})
+	fallback := c.fallback
+
+	(&routeCounter{counter: c}).Config(10, time.Hour)
+	if c.fallback != fallback {
+		t.Error("a route namespace replaced the shared fallback")
+	}
+	if c.fallbackWindow != time.Hour {
+		t.Errorf("fallback window = %v, want the longest window 1h", c.fallbackWindow)
+	}
+}
+
+func TestForTenantIsolation(t *testing.T) {
+	c, mr := newTestCounter(t, nil)
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+	acme, globex := c.ForTenant("acme"), c.ForTenant("globex")
+
+	for i := 0; i < 3; i++ {
+		if err := acme.Increment("key", now); err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+	}
+	if err := globex.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+
+	for name, tt := range map[string]struct {
+		counter *RedisLimitCounter
+		want    int
+	}{"acme": {acme, 3}, "globex": {globex, 1}, "parent": {c, 0}} {
+		if curr, _, err := tt.counter.Get("key", now, prev); err != nil || curr != tt.want {
+			t.Errorf("%s count = %d, %v, want %d, nil", name, curr, err, tt.want)
+		}
+	}
+
+	// each tenant's keys are under its own prefix
+	for _, key := range mr.Keys() {
+		if !strings.HasPrefix(key, DefaultPrefix+"acme:") && !strings.HasPrefix(key, DefaultPrefix+"globex:") {
+			t.Errorf("key %s isn't under a tenant prefix", key)
+		}
+	}
+
+	// closing a tenant leaves the shared connection open
+	if err := acme.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if curr, _, err := globex.Get("key", now, prev); err != nil || curr != 1 {
+		t.Errorf("globex count after closing acme = %d, %v, want 1, nil", curr, err)
+	}
+}
@@ -0,0 +1,36 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rueian/rueidis"
+)
+
+// masterNodes returns the nodes of client that aren't replicas. rueidis
+// lists the replicas of a cluster among its nodes, and commands that read
+// or write every key, like SCAN or FUNCTION LOAD, must skip them. A node
+// that doesn't support ROLE is taken to be a master.
+func masterNodes(ctx context.Context, client rueidis.Client) (map[string]rueidis.Client, error) {
+	nodes := client.Nodes()
+	masters := make(map[string]rueidis.Client, len(nodes))
+	for addr, node := range nodes {
+		role, err := node.Do(ctx, node.B().Role().Build()).ToArray()
+		var redisErr *rueidis.RedisError
+		if errors.As(err, &redisErr) {
+			masters[addr] = node
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("redis role of %s failed: %w", addr, classify(err))
+		}
+		if len(role) > 0 {
+			if name, _ := role[0].ToString(); name != "master" {
+				continue
+			}
+		}
+		masters[addr] = node
+	}
+	return masters, nil
+}
@@ -0,0 +1,26 @@
+package httprateredis
+
+import (
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+type noopCounter struct{}
+
+// NewNoopLimitCounter returns a LimitCounter that counts nothing, so
+// requests are never limited. It's handy for running without Redis in
+// development while keeping the middleware in place.
+func NewNoopLimitCounter() httprate.LimitCounter {
+	return noopCounter{}
+}
+
+func (noopCounter) Config(requestLimit int, windowLength time.Duration) {}
+
+func (noopCounter) Increment(key string, currentWindow time.Time) error {
+	return nil
+}
+
+func (noopCounter) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	return 0, 0, nil
+}
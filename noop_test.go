@@ -0,0 +1,25 @@
+package httprateredis
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+func TestNoopLimitCounterNeverLimits(t *testing.T) {
+	c := NewNoopLimitCounter()
+	limiter := httprate.Limit(1, time.Minute, httprate.WithLimitCounter(c))(okHandler)
+
+	for i := 0; i < 100; i++ {
+		if code := serve(limiter); code != http.StatusOK {
+			t.Fatalf("request %d = %d, want 200", i, code)
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	if curr, prev, err := c.Get("", now, now.Add(-time.Minute)); curr != 0 || prev != 0 || err != nil {
+		t.Errorf("Get after 100 requests = %d, %d, %v, want 0, 0, nil", curr, prev, err)
+	}
+}
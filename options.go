@@ -0,0 +1,116 @@
+package httprateredis
+
+import (
+	"crypto/tls"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures a counter built by NewRedisLimitCounterWithOptions.
+type Option func(cfg *Config)
+
+// NewRedisLimitCounterWithOptions returns a new redis-based LimitCounter
+// configured by opts. With no options it behaves like NewRedisLimitCounter(nil).
+func NewRedisLimitCounterWithOptions(opts ...Option) (*RedisLimitCounter, error) {
+	cfg := &Config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return NewRedisLimitCounter(cfg)
+}
+
+// WithAddresses sets the Redis host/ports to connect to.
+func WithAddresses(addresses ...string) Option {
+	return func(cfg *Config) {
+		cfg.Addresses = addresses
+	}
+}
+
+// WithPassword sets the Redis password.
+func WithPassword(password string) Option {
+	return func(cfg *Config) {
+		cfg.Password = password
+	}
+}
+
+// WithDBIndex sets the DB index to select.
+func WithDBIndex(index int) Option {
+	return func(cfg *Config) {
+		cfg.DBIndex = index
+	}
+}
+
+// WithLogicalDB sets the logical DB counters are isolated in.
+func WithLogicalDB(db int) Option {
+	return func(cfg *Config) {
+		cfg.LogicalDB = db
+	}
+}
+
+// WithPrefix sets the prefix prepended to every counter key.
+func WithPrefix(prefix string) Option {
+	return func(cfg *Config) {
+		cfg.PrefixKey = prefix
+	}
+}
+
+// WithTLS connects over TLS using tlsConfig, or a default config if nil.
+func WithTLS(tlsConfig *tls.Config) Option {
+	return func(cfg *Config) {
+		cfg.EnableTLS = true
+		cfg.TLSConfig = tlsConfig
+	}
+}
+
+// WithMetricsHook sets the hook that observes every Redis increment and get.
+func WithMetricsHook(hook MetricsHook) Option {
+	return func(cfg *Config) {
+		cfg.Metrics = hook
+	}
+}
+
+// WithTracer sets the tracer used to create a span around every Redis
+// increment and get.
+func WithTracer(tracer trace.Tracer) Option {
+	return func(cfg *Config) {
+		cfg.Tracer = tracer
+	}
+}
+
+// WithLogger sets the logger that failed Redis increments and gets are
+// logged to.
+func WithLogger(logger Logger) Option {
+	return func(cfg *Config) {
+		cfg.Logger = logger
+	}
+}
+
+// WithOnError sets the callback failed Redis increments and gets are
+// reported to.
+func WithOnError(fn func(err error)) Option {
+	return func(cfg *Config) {
+		cfg.OnError = fn
+	}
+}
+
+// WithClock sets the function the counter reads the current time from.
+func WithClock(clock func() time.Time) Option {
+	return func(cfg *Config) {
+		cfg.Clock = clock
+	}
+}
+
+// WithKeyFunc sets the function Redis keys are built with.
+func WithKeyFunc(fn func(baseKey string, window time.Time) string) Option {
+	return func(cfg *Config) {
+		cfg.KeyFunc = fn
+	}
+}
+
+// WithFailMode sets how calls are answered when Redis fails.
+func WithFailMode(mode FailMode) Option {
+	return func(cfg *Config) {
+		cfg.FailMode = mode
+	}
+}
@@ -0,0 +1,68 @@
+package httprateredis
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestOptions(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "redis.internal"}
+	hook := &metricsHook{}
+	clock := func() time.Time { return time.Time{} }
+	onError := func(error) {}
+	keyFunc := func(string, time.Time) string { return "" }
+
+	tests := []struct {
+		name  string
+		opt   Option
+		check func(cfg *Config) bool
+	}{
+		{"addresses", WithAddresses("a:1", "b:2"), func(cfg *Config) bool { return len(cfg.Addresses) == 2 && cfg.Addresses[1] == "b:2" }},
+		{"password", WithPassword("secret"), func(cfg *Config) bool { return cfg.Password == "secret" }},
+		{"db index", WithDBIndex(3), func(cfg *Config) bool { return cfg.DBIndex == 3 }},
+		{"logical db", WithLogicalDB(4), func(cfg *Config) bool { return cfg.LogicalDB == 4 }},
+		{"prefix", WithPrefix("app:"), func(cfg *Config) bool { return cfg.PrefixKey == "app:" }},
+		{"tls", WithTLS(tlsConfig), func(cfg *Config) bool { return cfg.EnableTLS && cfg.TLSConfig == tlsConfig }},
+		{"default tls", WithTLS(nil), func(cfg *Config) bool { return cfg.EnableTLS && cfg.TLSConfig == nil }},
+		{"metrics", WithMetricsHook(hook), func(cfg *Config) bool { return cfg.Metrics == hook }},
+		{"logger", WithLogger(&testLogger{}), func(cfg *Config) bool { return cfg.Logger != nil }},
+		{"on error", WithOnError(onError), func(cfg *Config) bool { return cfg.OnError != nil }},
+		{"clock", WithClock(clock), func(cfg *Config) bool { return cfg.Clock != nil && cfg.Clock().IsZero() }},
+		{"key func", WithKeyFunc(keyFunc), func(cfg *Config) bool { return cfg.KeyFunc != nil }},
+		{"fail mode", WithFailMode(FailOpen), func(cfg *Config) bool { return cfg.FailMode == FailOpen }},
+	}
+	for _, tt := range tests {
+		cfg := &Config{}
+		tt.opt(cfg)
+		if !tt.check(cfg) {
+			t.Errorf("%s option: config = %+v", tt.name, cfg)
+		}
+	}
+}
+
+func TestNewRedisLimitCounterWithOptions(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	c, err := NewRedisLimitCounterWithOptions(WithAddresses(mr.Addr()))
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounterWithOptions: %v", err)
+	}
+	defer c.Close()
+
+	// unset options keep their defaults
+	if c.prefix != DefaultPrefix || c.timeout != defaultTimeout || c.expiry != DefaultExpiryMultiplier || c.failMode != FailClosed {
+		t.Errorf("defaults = prefix %q, timeout %v, expiry %v, fail mode %v", c.prefix, c.timeout, c.expiry, c.failMode)
+	}
+
+	c, err = NewRedisLimitCounterWithOptions(WithAddresses(mr.Addr()), WithPrefix("app:"), WithFailMode(FailOpen))
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounterWithOptions: %v", err)
+	}
+	defer c.Close()
+	if c.prefix != "app:" || c.failMode != FailOpen {
+		t.Errorf("options weren't applied: prefix %q, fail mode %v", c.prefix, c.failMode)
+	}
+}
@@ -0,0 +1,75 @@
+package httprateredis
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Quota is a limit of requests per window, for CheckAll.
+type Quota struct {
+	Limit  int
+	Window time.Duration
+}
+
+// CheckAll decides whether key may make another request under every quota,
+// such as both a per-second burst limit and a per-hour sustained limit, and
+// counts it against all of them if so. The decision is made in a single
+// script, using the same sliding window weighting as AllowWeighted, so its
+// keys must map to the same slot like those of AllowWeighted. In ShadowMode
+// every request is counted and allowed.
+func (c *RedisLimitCounter) CheckAll(key string, quotas []Quota) (bool, error) {
+	if len(quotas) == 0 {
+		return false, errors.New("redis check failed: no quotas given")
+	}
+
+	now := c.clock()
+	keys := make([]string, 0, 2*len(quotas))
+	args := make([]string, 0, 4*len(quotas)+1)
+	for i, q := range quotas {
+		if q.Window < time.Millisecond {
+			return false, fmt.Errorf("redis check failed: quota %d window must be at least 1ms, got %v", i, q.Window)
+		}
+
+		currentWindow := now.UTC().Truncate(q.Window)
+		previousWindow := currentWindow.Add(-q.Window)
+		keys = append(keys, quotaKey(c.limitCounterKey(key, currentWindow), q.Window), quotaKey(c.limitCounterKey(key, previousWindow), q.Window))
+		args = append(args,
+			c.expiryMillis(currentWindow, q.Window),
+			strconv.Itoa(q.Limit),
+			strconv.FormatInt(q.Window.Milliseconds(), 10),
+			strconv.FormatInt(now.Sub(currentWindow).Milliseconds(), 10),
+		)
+	}
+
+	if err := checkSlot(keys...); err != nil {
+		return false, fmt.Errorf("redis check failed: %w", err)
+	}
+
+	ctx, cancel := c.opContext(c.ctx)
+	defer cancel()
+
+	result, err := checkAllScript.Exec(ctx, c.client, keys, append(args, shadowArg(c.shadow))).AsIntSlice()
+	if err != nil {
+		return false, fmt.Errorf("redis check failed: %w", classify(err))
+	}
+	if err := checkReplies(len(result), 3); err != nil {
+		return false, fmt.Errorf("redis check failed: %w", err)
+	}
+
+	allowed := result[0] == 1
+	if c.shadow && !allowed {
+		c.observeWouldBlock(key, int(result[2]), quotas[result[1]-1].Limit)
+		allowed = true
+	}
+	c.observeDecision(allowed)
+	return allowed, nil
+}
+
+// quotaKey suffixes a counter key with its window length, so that quotas
+// whose windows start at the same instant don't share a counter. The suffix
+// keeps the key in the same cluster slot.
+func quotaKey(hkey string, window time.Duration) string {
+	return hkey + ":" + strconv.FormatInt(window.Milliseconds(), 10)
+}
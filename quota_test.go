@@ -0,0 +1,89 @@
+package httprateredis
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckAllPerHourQuota(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	// the quotas' keys are read by one script, so must share a slot
+	c, _ := newTestCounter(t, &Config{ClusterMode: true, Clock: func() time.Time { return now }})
+	quotas := []Quota{{Limit: 2, Window: time.Second}, {Limit: 5, Window: time.Hour}}
+
+	// one request every two seconds never reaches the per-second limit
+	for i := 0; i < 5; i++ {
+		now = start.Add(time.Duration(2*i) * time.Second)
+		if ok, err := c.CheckAll("key", quotas); err != nil || !ok {
+			t.Fatalf("request %d = %v, %v, want allowed", i, ok, err)
+		}
+	}
+	now = start.Add(10 * time.Second)
+	if ok, err := c.CheckAll("key", quotas); err != nil || ok {
+		t.Errorf("request over the hourly quota = %v, %v, want denied", ok, err)
+	}
+
+	// a denied request isn't counted against the quotas it was under
+	if curr, _, err := c.GetWindow("key", now.Truncate(time.Second), now.Truncate(time.Second).Add(-time.Second), time.Second); err != nil || curr != 0 {
+		t.Errorf("per-second count = %d, %v, want 0, nil", curr, err)
+	}
+}
+
+func TestCheckAllPerSecondQuota(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c, _ := newTestCounter(t, &Config{ClusterMode: true, Clock: fixedClock(now)})
+	quotas := []Quota{{Limit: 2, Window: time.Second}, {Limit: 5, Window: time.Hour}}
+
+	for i, want := range []bool{true, true, false} {
+		if ok, err := c.CheckAll("key", quotas); err != nil || ok != want {
+			t.Errorf("request %d = %v, %v, want %v", i, ok, err, want)
+		}
+	}
+}
+
+func TestCheckAllShadowMode(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	hook := &shadowHook{}
+	c, mr := newTestCounter(t, &Config{ClusterMode: true, ShadowMode: true, Metrics: hook, Clock: fixedClock(now)})
+	quotas := []Quota{{Limit: 5, Window: time.Second}, {Limit: 1, Window: time.Hour}}
+
+	for i := 0; i < 3; i++ {
+		if ok, err := c.CheckAll("key", quotas); err != nil || !ok {
+			t.Errorf("request %d = %v, %v, want allowed", i, ok, err)
+		}
+	}
+	// every request was counted against every quota
+	for _, q := range quotas {
+		if got, _ := mr.Get(quotaKey(c.limitCounterKey("key", now.Truncate(q.Window)), q.Window)); got != "3" {
+			t.Errorf("count of the %v quota = %q, want 3", q.Window, got)
+		}
+	}
+	// and those over the per-hour quota reported against its limit
+	if want := []int{1, 2}; !reflect.DeepEqual(hook.wouldBlocks, want) || !reflect.DeepEqual(hook.limits, []int{1, 1}) {
+		t.Errorf("ObserveWouldBlock got %v with limits %v, want %v with 1", hook.wouldBlocks, hook.limits, want)
+	}
+}
+
+func TestCheckAllCrossSlot(t *testing.T) {
+	c, mr := newTestCounter(t, nil)
+	quotas := []Quota{{Limit: 2, Window: time.Second}, {Limit: 5, Window: time.Hour}}
+	if _, err := c.CheckAll("key", quotas); !errors.Is(err, ErrCrossSlot) {
+		t.Errorf("CheckAll = %v, want ErrCrossSlot", err)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("keys written: %v", keys)
+	}
+}
+
+func TestCheckAllValidates(t *testing.T) {
+	c := newRedisLimitCounter(nil, &Config{})
+	if _, err := c.CheckAll("key", nil); err == nil {
+		t.Error("CheckAll with no quotas succeeded")
+	}
+	if _, err := c.CheckAll("key", []Quota{{Limit: 1, Window: time.Microsecond}}); err == nil {
+		t.Error("CheckAll with a sub-millisecond window succeeded")
+	}
+}
@@ -0,0 +1,88 @@
+// Package redistest starts disposable Redis servers for integration tests.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	httprateredis "github.com/Keanu73/httprate-redis"
+)
+
+// Image is the Docker image StartTestRedis runs.
+var Image = "redis:7-alpine"
+
+// StartTestRedis starts a Redis container and returns a Config pointing at
+// it, along with a function that removes the container. The test is skipped
+// when Docker isn't available.
+func StartTestRedis(t *testing.T) (*httprateredis.Config, func()) {
+	t.Helper()
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("redistest: docker is not installed")
+	}
+	if err := exec.Command("docker", "info").Run(); err != nil {
+		t.Skip("redistest: docker daemon is not available")
+	}
+
+	out, err := exec.Command("docker", "run", "-d", "--rm", "-p", "127.0.0.1::6379", Image).Output()
+	if err != nil {
+		t.Fatalf("redistest: unable to start redis container: %v", err)
+	}
+	id := strings.TrimSpace(string(out))
+	cleanup := func() {
+		exec.Command("docker", "rm", "-f", id).Run()
+	}
+
+	out, err = exec.Command("docker", "port", id, "6379/tcp").Output()
+	if err != nil {
+		cleanup()
+		t.Fatalf("redistest: unable to read redis container port: %v", err)
+	}
+	addr := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	if err := waitForRedis(addr, 30*time.Second); err != nil {
+		cleanup()
+		t.Fatalf("redistest: redis container did not become ready: %v", err)
+	}
+
+	return &httprateredis.Config{Addresses: []string{addr}}, cleanup
+}
+
+// waitForRedis pings addr until it answers or timeout passes
+func waitForRedis(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := ping(addr)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// ping sends a PING to addr and checks for a PONG
+func ping(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(reply, "+PONG") {
+		return fmt.Errorf("unexpected ping reply %q", strings.TrimSpace(reply))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package httprateredis
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// requestContextSep separates a rate-limit key from the id of the request
+// context registered for it by WithRequestContext
+const requestContextSep = "\x00ctx:"
+
+// requestContexts holds the contexts of the requests WithRequestContext is
+// serving, by id
+type requestContexts struct {
+	next     atomic.Uint64
+	contexts sync.Map
+}
+
+// requestContextKey is the request context key of a request's id
+type requestContextKey struct{}
+
+// WithRequestContext is middleware that lets Increment and Get run under the
+// context of the request being limited, so that they're canceled with it
+// and bound by its deadline as well as Timeout. httprate doesn't pass
+// contexts to its counter, so the context is carried in the key instead:
+// the limiter must run inside this middleware, and KeyByRequestContext must
+// be its last key func:
+/*
+	r.Use(counter.WithRequestContext())
+	r.Use(httprate.Limit(100, time.Minute,
+		httprate.WithKeyFuncs(httprate.KeyByIP, counter.KeyByRequestContext),
+		httprate.WithLimitCounter(counter),
+	))
+*/
+// Each request gets its own id in its key, which the counter strips before
+// counting, so concurrent requests of the same key neither share contexts
+// nor counts. Contexts are only held while the request is served; keys
+// without a known id use the base context, as do coalesced increments,
+// which outlive their requests.
+func (c *RedisLimitCounter) WithRequestContext() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := strconv.FormatUint(c.reqContexts.next.Add(1), 36)
+			c.reqContexts.contexts.Store(id, r.Context())
+			defer c.reqContexts.contexts.Delete(id)
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestContextKey{}, id)))
+		})
+	}
+}
+
+// KeyByRequestContext is an httprate.KeyFunc adding the id of the request's
+// context to its key, see WithRequestContext. It adds nothing to requests
+// served outside of WithRequestContext.
+func (c *RedisLimitCounter) KeyByRequestContext(r *http.Request) (string, error) {
+	id, ok := r.Context().Value(requestContextKey{}).(string)
+	if !ok {
+		return "", nil
+	}
+	return requestContextSep + id, nil
+}
+
+// requestContext strips the request context id from key, returning the
+// context registered for it, or the base context
+func (c *RedisLimitCounter) requestContext(key string) (context.Context, string) {
+	i := strings.LastIndex(key, requestContextSep)
+	if i < 0 {
+		return c.ctx, key
+	}
+
+	ctx, ok := c.reqContexts.contexts.Load(key[i+len(requestContextSep):])
+	if !ok {
+		return c.ctx, key[:i]
+	}
+	return ctx.(context.Context), key[:i]
+}
@@ -0,0 +1,64 @@
+package httprateredis
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+func TestWithRequestContext(t *testing.T) {
+	c := newRedisLimitCounter(blockingClient(t), &Config{Timeout: 5 * time.Second})
+	limit := httprate.Limit(10, time.Minute,
+		httprate.WithKeyFuncs(httprate.KeyByIP, c.KeyByRequestContext),
+		httprate.WithLimitCounter(c),
+	)
+	h := c.WithRequestContext()(limit(okHandler))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	h.ServeHTTP(w, r)
+	// the blocked call gave up with the request rather than after Timeout
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request took %v", elapsed)
+	}
+	if w.Code == http.StatusOK {
+		t.Errorf("request = %d, want the counter to have failed", w.Code)
+	}
+
+	// the context is dropped once the request is served
+	n := 0
+	c.reqContexts.contexts.Range(func(_, _ any) bool { n++; return true })
+	if n != 0 {
+		t.Errorf("%d request contexts held after the request", n)
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	c := newRedisLimitCounter(blockingClient(t), &Config{})
+	reqCtx := context.WithValue(context.Background(), requestContextKey{}, "request")
+	c.reqContexts.contexts.Store("1", reqCtx)
+
+	for _, tt := range []struct {
+		key     string
+		wantCtx context.Context
+		wantKey string
+	}{
+		{"key" + requestContextSep + "1", reqCtx, "key"},
+		// an unknown id is still stripped, so that it isn't counted on its own
+		{"key" + requestContextSep + "2", c.ctx, "key"},
+		{"key", c.ctx, "key"},
+	} {
+		ctx, key := c.requestContext(tt.key)
+		if ctx != tt.wantCtx || key != tt.wantKey {
+			t.Errorf("requestContext(%q) = %v, %q, want %v, %q", tt.key, ctx, key, tt.wantCtx, tt.wantKey)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/rueian/rueidis"
+)
+
+// retry runs fn, retrying transient failures up to maxRetries times with
+// exponential backoff, until ctx is done
+func (c *RedisLimitCounter) retry(ctx context.Context, fn func() error) error {
+	return c.retryIf(ctx, isTransient, fn)
+}
+
+// retryWrite is retry for commands that mustn't run twice, like an INCRBY,
+// retrying only failures that happened before the command reached Redis
+func (c *RedisLimitCounter) retryWrite(ctx context.Context, fn func() error) error {
+	return c.retryIf(ctx, isUnsent, fn)
+}
+
+// retryIf runs fn, retrying the failures retryable reports true for
+func (c *RedisLimitCounter) retryIf(ctx context.Context, retryable func(error) bool, fn func() error) error {
+	err := fn()
+	for attempt := 0; attempt < c.maxRetries && retryable(err); attempt++ {
+		timer := time.NewTimer(c.retryBackoff << attempt)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = fn()
+	}
+	return err
+}
+
+// isTransient reports whether err is worth retrying, i.e. a connection
+// error or a cluster redirection error rather than a cancelled context, a
+// missing key, a failed command or an error of the counter itself
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, rueidis.ErrClosing) {
+		return false
+	}
+	if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrCommand) || errors.Is(err, ErrTooManyOps) || errors.Is(err, ErrShuttingDown) {
+		return false
+	}
+	var redisErr *rueidis.RedisError
+	if errors.As(err, &redisErr) {
+		return redisErr.IsTryAgain() || redisErr.IsClusterDown()
+	}
+	return true
+}
+
+// isUnsent reports whether err is transient and Redis can't have run the
+// command: it was refused with TRYAGAIN or CLUSTERDOWN, or the connection
+// couldn't be dialed. A reset connection or a timeout may have come after
+// the command ran, so retrying those could count an increment twice.
+func isUnsent(err error) bool {
+	if !isTransient(err) {
+		return false
+	}
+	var redisErr *rueidis.RedisError
+	if errors.As(err, &redisErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
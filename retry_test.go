@@ -0,0 +1,87 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rueian/rueidis"
+	"github.com/rueian/rueidis/mock"
+)
+
+func TestIsTransient(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+		unsent    bool
+	}{
+		{"nil", nil, false, false},
+		{"dial", classify(dial), true, true},
+		{"reset", classify(io.EOF), true, false},
+		{"try again", classify(mock.Result(mock.RedisError("TRYAGAIN retry")).Error()), true, true},
+		{"cluster down", classify(mock.Result(mock.RedisError("CLUSTERDOWN down")).Error()), true, true},
+		{"command", classify(mock.Result(mock.RedisError("ERR wrong type")).Error()), false, false},
+		{"truncated reply", checkReplies(1, 2), false, false},
+		{"command timeout", fmt.Errorf("%w: GET took over 1s", ErrCommandTimeout), true, false},
+		{"canceled", context.Canceled, false, false},
+		{"deadline", fmt.Errorf("redis get failed: %w", context.DeadlineExceeded), false, false},
+		{"closing", classify(rueidis.ErrClosing), false, false},
+		{"key not found", ErrKeyNotFound, false, false},
+		{"too many ops", ErrTooManyOps, false, false},
+		{"shutting down", ErrShuttingDown, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.transient {
+				t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.transient)
+			}
+			if got := isUnsent(tt.err); got != tt.unsent {
+				t.Errorf("isUnsent(%v) = %v, want %v", tt.err, got, tt.unsent)
+			}
+		})
+	}
+}
+
+func TestIncrementNotRetriedAfterWrite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mock.NewClient(ctrl)
+
+	c := NewRedisLimitCounterWithClient(client)
+	c.Config(10, time.Minute)
+	c.maxRetries = 3
+	c.retryBackoff = time.Millisecond
+
+	// the connection dropped after the increment was sent
+	client.EXPECT().Do(gomock.Any(), gomock.Any()).Return(mock.ErrorResult(io.EOF)).Times(1)
+
+	if err := c.Increment("key", time.Now()); !errors.Is(err, io.EOF) {
+		t.Fatalf("Increment = %v, want io.EOF", err)
+	}
+}
+
+func TestIncrementRetriedBeforeWrite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mock.NewClient(ctrl)
+
+	c := NewRedisLimitCounterWithClient(client)
+	c.Config(10, time.Minute)
+	c.maxRetries = 3
+	c.retryBackoff = time.Millisecond
+
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	gomock.InOrder(
+		client.EXPECT().Do(gomock.Any(), gomock.Any()).Return(mock.ErrorResult(dial)).Times(2),
+		client.EXPECT().Do(gomock.Any(), gomock.Any()).Return(mock.Result(mock.RedisInt64(1))),
+	)
+
+	if err := c.Increment("key", time.Now()); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+}
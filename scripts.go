@@ -0,0 +1,238 @@
+package httprateredis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/rueian/rueidis"
+)
+
+// script is a Lua script that can be run once with Exec, or pipelined with
+// execMulti.
+type script struct {
+	*rueidis.Lua
+	body string
+	sha1 string
+}
+
+func newScript(body string) *script {
+	sum := sha1.Sum([]byte(body))
+	return &script{
+		Lua:  rueidis.NewLuaScript(body),
+		body: body,
+		sha1: hex.EncodeToString(sum[:]),
+	}
+}
+
+// execMulti runs every exec of the script in a single round-trip with
+// EVALSHA, then reruns with EVAL any that failed because the script isn't
+// loaded yet.
+func (s *script) execMulti(ctx context.Context, client rueidis.Client, multi ...rueidis.LuaExec) []rueidis.RedisResult {
+	cmds := make(rueidis.Commands, 0, len(multi))
+	for _, m := range multi {
+		cmds = append(cmds, client.B().Evalsha().Sha1(s.sha1).Numkeys(int64(len(m.Keys))).Key(m.Keys...).Arg(m.Args...).Build())
+	}
+	result := client.DoMulti(ctx, cmds...)
+
+	var retry []int
+	cmds = cmds[:0]
+	for i, response := range result {
+		if err := response.RedisError(); err != nil && err.IsNoScript() {
+			retry = append(retry, i)
+			cmds = append(cmds, client.B().Eval().Script(s.body).Numkeys(int64(len(multi[i].Keys))).Key(multi[i].Keys...).Arg(multi[i].Args...).Build())
+		}
+	}
+	if len(retry) > 0 {
+		for i, response := range client.DoMulti(ctx, cmds...) {
+			if i < len(retry) {
+				result[retry[i]] = response
+			}
+		}
+	}
+
+	return result
+}
+
+// incrementScript increments a window counter by ARGV[2] and sets its TTL
+// only when it has none, so the TTL is always applied and never extended.
+var incrementScript = newScript(`
+local count = redis.call('INCRBY', KEYS[1], ARGV[2])
+if redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// incrementFieldScript increments field ARGV[3] of a window hash by ARGV[2]
+// like incrementScript, so the hash gets a single TTL shared by its fields.
+var incrementFieldScript = newScript(`
+local count = redis.call('HINCRBY', KEYS[1], ARGV[3], ARGV[2])
+if redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// slidingWindowScript trims request timestamps older than the window from a
+// sorted set, then records the request only if the remaining count is below
+// the limit. It returns {allowed, count}.
+var slidingWindowScript = newScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], math.ceil(window / 1000))
+	return {1, count + 1}
+end
+return {0, count}
+`)
+
+// tokenBucketScript refills a bucket by the time elapsed since its last
+// refill, then takes one token if available. It returns {allowed, remaining}.
+var tokenBucketScript = newScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000000)
+	ts = now
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, math.floor(tokens)}
+`)
+
+// incrementAndGetScript increments the current window counter like
+// incrementScript, and returns it along with the previous window count.
+var incrementAndGetScript = newScript(`
+local curr = redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+local prev = tonumber(redis.call('GET', KEYS[2]) or 0)
+return {curr, prev}
+`)
+
+// allowWeightedScript weighs the previous window count like httprate does,
+// and only increments the current window counter if the result is below the
+// limit, or always when ARGV[5] is 1 for ShadowMode. It returns whether the
+// request was below the limit and the weighted count, including the request
+// if it was counted.
+var allowWeightedScript = newScript(`
+local curr = tonumber(redis.call('GET', KEYS[1]) or 0)
+local prev = tonumber(redis.call('GET', KEYS[2]) or 0)
+local window = tonumber(ARGV[3])
+local elapsed = tonumber(ARGV[4])
+local used = math.floor(prev * (window - elapsed) / window + curr + 0.5)
+local allowed = 1
+if used >= tonumber(ARGV[2]) then
+	if ARGV[5] ~= '1' then
+		return {0, used}
+	end
+	allowed = 0
+end
+redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {allowed, used + 1}
+`)
+
+// incrementIdempotentScript increments a window counter like
+// incrementScript, unless the idempotency key KEYS[2] has already been
+// seen. It returns 1 if the counter was incremented.
+var incrementIdempotentScript = newScript(`
+if not redis.call('SET', KEYS[2], 1, 'NX', 'PX', ARGV[3]) then
+	return 0
+end
+redis.call('INCRBY', KEYS[1], ARGV[2])
+if redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// checkAllScript runs the allowWeightedScript decision for several quotas of
+// one key, where quota i has window keys KEYS[2i-1] and KEYS[2i] and
+// arguments ARGV[4i-3..4i] of ttl, limit, window and elapsed. Every quota's
+// counter is incremented only if all of them are below their limit, or
+// always when the last argument is 1 for ShadowMode. It returns 1 if the
+// request was below every limit, or 0 along with the first quota it was over
+// and its weighted count.
+var checkAllScript = newScript(`
+local quotas = #KEYS / 2
+local over, used = 0, 0
+for i = 1, quotas do
+	local curr = tonumber(redis.call('GET', KEYS[2*i-1]) or 0)
+	local prev = tonumber(redis.call('GET', KEYS[2*i]) or 0)
+	local window = tonumber(ARGV[4*i-1])
+	local elapsed = tonumber(ARGV[4*i])
+	local count = math.floor(prev * (window - elapsed) / window + curr + 0.5)
+	if count >= tonumber(ARGV[4*i-2]) then
+		if ARGV[4*quotas+1] ~= '1' then
+			return {0, i, count}
+		end
+		if over == 0 then
+			over, used = i, count
+		end
+	end
+end
+for i = 1, quotas do
+	redis.call('INCR', KEYS[2*i-1])
+	if redis.call('PTTL', KEYS[2*i-1]) == -1 then
+		redis.call('PEXPIRE', KEYS[2*i-1], ARGV[4*i-3])
+	end
+end
+if over > 0 then
+	return {0, over, used}
+end
+return {1, 0, 0}
+`)
+
+// scripts lists every script run by the package, for LoadScripts
+var scripts = []*script{
+	incrementScript,
+	incrementFieldScript,
+	slidingWindowScript,
+	tokenBucketScript,
+	incrementAndGetScript,
+	allowWeightedScript,
+	incrementIdempotentScript,
+	checkAllScript,
+}
+
+// LoadScripts loads the package's Lua scripts on every Redis node with
+// SCRIPT LOAD. Scripts are always run with EVALSHA, falling back to EVAL
+// when a node doesn't have them, so this is only needed to avoid sending
+// their bodies on the first calls after a restart or failover.
+func (c *RedisLimitCounter) LoadScripts(ctx context.Context) error {
+	for addr, node := range c.client.Nodes() {
+		cmds := make(rueidis.Commands, 0, len(scripts))
+		for _, s := range scripts {
+			cmds = append(cmds, node.B().ScriptLoad().Script(s.body).Build())
+		}
+		for _, response := range node.DoMulti(ctx, cmds...) {
+			if err := response.Error(); err != nil {
+				return fmt.Errorf("redis script load on %s failed: %w", addr, classify(err))
+			}
+		}
+	}
+	return nil
+}
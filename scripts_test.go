@@ -0,0 +1,58 @@
+package httprateredis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rueian/rueidis"
+	"github.com/rueian/rueidis/mock"
+)
+
+// command matches a command named name
+func command(name string) gomock.Matcher {
+	return mock.MatchFn(func(cmd []string) bool { return cmd[0] == name }, name)
+}
+
+func TestExecMultiNoScriptFallback(t *testing.T) {
+	client := mock.NewClient(gomock.NewController(t))
+	gomock.InOrder(
+		client.EXPECT().DoMulti(gomock.Any(), command("EVALSHA"), command("EVALSHA"), command("EVALSHA")).Return([]rueidis.RedisResult{
+			mock.Result(mock.RedisInt64(1)),
+			mock.Result(mock.RedisError("NOSCRIPT No matching script. Please use EVAL.")),
+			mock.Result(mock.RedisInt64(3)),
+		}),
+		// only the exec that wasn't run is resent, with the script body
+		client.EXPECT().DoMulti(gomock.Any(), mock.MatchFn(func(cmd []string) bool {
+			return cmd[0] == "EVAL" && cmd[1] == incrementScript.body && cmd[3] == "b"
+		}, "EVAL of b")).Return([]rueidis.RedisResult{
+			mock.Result(mock.RedisInt64(2)),
+		}),
+	)
+
+	result := incrementScript.execMulti(context.Background(), client,
+		rueidis.LuaExec{Keys: []string{"a"}, Args: []string{"1000", "1"}},
+		rueidis.LuaExec{Keys: []string{"b"}, Args: []string{"1000", "1"}},
+		rueidis.LuaExec{Keys: []string{"c"}, Args: []string{"1000", "1"}},
+	)
+
+	if len(result) != 3 {
+		t.Fatalf("got %d results, want 3", len(result))
+	}
+	for i, response := range result {
+		if n, err := response.AsInt64(); err != nil || n != int64(i+1) {
+			t.Errorf("result %d = %d, %v, want %d, nil", i, n, err, i+1)
+		}
+	}
+}
+
+func TestExecMultiLoaded(t *testing.T) {
+	// gomock fails the test if the EVAL fallback is sent
+	client := mock.NewClient(gomock.NewController(t))
+	client.EXPECT().DoMulti(gomock.Any(), command("EVALSHA")).Return([]rueidis.RedisResult{mock.Result(mock.RedisInt64(1))})
+
+	result := incrementScript.execMulti(context.Background(), client, rueidis.LuaExec{Keys: []string{"a"}, Args: []string{"1000", "1"}})
+	if n, err := result[0].AsInt64(); err != nil || n != 1 {
+		t.Errorf("result = %d, %v, want 1, nil", n, err)
+	}
+}
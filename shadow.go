@@ -0,0 +1,70 @@
+package httprateredis
+
+import (
+	"math"
+	"time"
+)
+
+// ShadowMetricsHook is a MetricsHook that is also told about the requests
+// ShadowMode let through that would otherwise have been limited.
+type ShadowMetricsHook interface {
+	MetricsHook
+	// ObserveWouldBlock is called when key is over its limit in ShadowMode
+	ObserveWouldBlock(key string, used, limit int)
+}
+
+// getWindow gets the window counts of key for httprate's limit check,
+// reporting whether it will allow the request to Metrics
+func (c *RedisLimitCounter) getWindow(key string, currentWindow, previousWindow time.Time, requestLimit int, windowLength time.Duration) (int, int, error) {
+	curr, prev, err := c.readWindow(key, currentWindow, previousWindow, requestLimit, windowLength)
+	if err == nil {
+		used := int(math.Round(slidingRate(curr, prev, c.clock().Sub(currentWindow), windowLength)))
+		c.observeDecision(used < requestLimit)
+	}
+	return curr, prev, err
+}
+
+// readWindow gets the window counts of key. In ShadowMode it instead
+// reports whether key is over requestLimit and returns zero counts, so
+// httprate allows every request.
+func (c *RedisLimitCounter) readWindow(key string, currentWindow, previousWindow time.Time, requestLimit int, windowLength time.Duration) (int, int, error) {
+	curr, prev, err := c.countWindow(key, currentWindow, previousWindow, windowLength)
+	if !c.shadow {
+		return curr, prev, err
+	}
+
+	if err == nil {
+		used := int(math.Round(slidingRate(curr, prev, c.clock().Sub(currentWindow), windowLength)))
+		if used >= requestLimit {
+			_, key := c.requestContext(key)
+			c.observeWouldBlock(key, used, requestLimit)
+		}
+	}
+	return 0, 0, nil
+}
+
+// countWindow gets the stored window counts of key, whatever the mode
+func (c *RedisLimitCounter) countWindow(key string, currentWindow, previousWindow time.Time, windowLength time.Duration) (int, int, error) {
+	ctx, key := c.requestContext(key)
+	if err := c.checkKey(key); err != nil {
+		return 0, 0, err
+	}
+	return c.getCounts(ctx, key, currentWindow, previousWindow, windowLength)
+}
+
+// observeWouldBlock reports key being over limit in ShadowMode to Metrics if
+// it is a ShadowMetricsHook
+func (c *RedisLimitCounter) observeWouldBlock(key string, used, limit int) {
+	if hook, ok := c.metrics.(ShadowMetricsHook); ok {
+		hook.ObserveWouldBlock(key, used, limit)
+	}
+}
+
+// shadowArg returns the script argument telling the limit scripts whether
+// to count requests over the limit, as ShadowMode does
+func shadowArg(shadow bool) string {
+	if shadow {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,57 @@
+package httprateredis
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+func TestShadowMode(t *testing.T) {
+	hook := &shadowHook{}
+	c, _ := newTestCounter(t, &Config{ShadowMode: true, Metrics: hook})
+	limiter := httprate.Limit(3, time.Minute, httprate.WithLimitCounter(c))(okHandler)
+
+	for i := 0; i < 6; i++ {
+		if code := serve(limiter); code != http.StatusOK {
+			t.Errorf("request %d = %d, want 200", i, code)
+		}
+	}
+
+	// every request was counted, and those from the limit on would have
+	// been blocked
+	now := time.Now().UTC().Truncate(time.Minute)
+	if curr, _, err := c.countWindow("*", now, now.Add(-time.Minute), time.Minute); err != nil || curr != 6 {
+		t.Errorf("count = %d, %v, want 6, nil", curr, err)
+	}
+	if want := []int{3, 4, 5}; !reflect.DeepEqual(hook.wouldBlocks, want) {
+		t.Errorf("ObserveWouldBlock got %v, want %v", hook.wouldBlocks, want)
+	}
+}
+
+func TestShadowModeAllow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	hook := &shadowHook{}
+	c, _ := newTestCounter(t, &Config{ClusterMode: true, ShadowMode: true, Metrics: hook, Clock: fixedClock(start)})
+
+	for i := 0; i < 5; i++ {
+		if ok, err := c.Allow("job", 2, time.Minute); err != nil || !ok {
+			t.Errorf("Allow %d = %v, %v, want true, nil", i, ok, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if ok, used, err := c.AllowWeighted("key", 1, start, start.Add(-time.Minute)); err != nil || !ok || used != i+1 {
+			t.Errorf("AllowWeighted %d = %v, %d, %v, want true, %d, nil", i, ok, used, err, i+1)
+		}
+	}
+
+	// every request was counted, including those over the limit
+	if curr, _, err := c.countWindow("key", start, start.Add(-time.Minute), time.Minute); err != nil || curr != 2 {
+		t.Errorf("count = %d, %v, want 2, nil", curr, err)
+	}
+	if want := []int{2, 3, 4, 1}; !reflect.DeepEqual(hook.wouldBlocks, want) {
+		t.Errorf("ObserveWouldBlock got %v, want %v", hook.wouldBlocks, want)
+	}
+}
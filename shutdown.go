@@ -0,0 +1,67 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrShuttingDown is returned by Increment and Get once Shutdown or Close
+// has been called.
+var ErrShuttingDown = errors.New("redis limit counter is shutting down")
+
+// drain tracks in-flight operations so that Shutdown can wait for them
+type drain struct {
+	mu           sync.RWMutex
+	shuttingDown bool
+	inflight     sync.WaitGroup
+}
+
+// begin registers an in-flight operation, returning false once the counter
+// is shutting down
+func (d *drain) begin() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.shuttingDown {
+		return false
+	}
+	d.inflight.Add(1)
+	return true
+}
+
+// end marks an operation registered by begin as done
+func (d *drain) end() {
+	d.inflight.Done()
+}
+
+// stop makes every following begin fail
+func (d *drain) stop() {
+	d.mu.Lock()
+	d.shuttingDown = true
+	d.mu.Unlock()
+}
+
+// Shutdown rejects new Increment and Get calls with ErrShuttingDown, waits
+// for in-flight ones to finish, then closes the counter. If ctx expires
+// first, the counter is closed anyway and the context's error is returned.
+func (c *RedisLimitCounter) Shutdown(ctx context.Context) error {
+	c.drain.stop()
+
+	done := make(chan struct{})
+	go func() {
+		c.drain.inflight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if closeErr := c.Close(); closeErr != nil {
+		return closeErr
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rueian/rueidis"
+	"github.com/rueian/rueidis/mock"
+)
+
+func TestShutdownWaitsForTenantCalls(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mock.NewClient(ctrl)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	client.EXPECT().Do(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, cmd any) rueidis.RedisResult {
+		close(started)
+		<-release
+		return mock.Result(mock.RedisInt64(1))
+	})
+
+	c := NewRedisLimitCounterWithClient(client)
+	c.Config(10, time.Minute)
+	tenant := c.ForTenant("acme")
+
+	done := make(chan error, 1)
+	go func() { done <- tenant.Increment("key", time.Now()) }()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown with a slow tenant call = %v, want it to wait until the deadline", err)
+	}
+
+	if err := tenant.Increment("key", time.Now()); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("tenant Increment after Shutdown = %v, want ErrShuttingDown", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("in-flight tenant Increment: %v", err)
+	}
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown once in-flight calls are done: %v", err)
+	}
+}
+
+func TestShutdownRejectsNewCalls(t *testing.T) {
+	c, _ := newTestCounter(t, nil)
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := c.Increment("key", now); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Increment after Shutdown = %v, want ErrShuttingDown", err)
+	}
+	if _, _, err := c.Get("key", now, now.Add(-time.Minute)); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Get after Shutdown = %v, want ErrShuttingDown", err)
+	}
+}
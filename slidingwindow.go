@@ -0,0 +1,77 @@
+package httprateredis
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// SlidingWindowCounter limits requests over an exact sliding window by
+// logging each allowed request's timestamp in a Redis sorted set. Unlike the
+// httprate.LimitCounter window approximation it has no bursts at window
+// boundaries, at the cost of storing one entry per request.
+type SlidingWindowCounter struct {
+	counter *RedisLimitCounter
+	limit   int
+	window  time.Duration
+}
+
+// NewSlidingWindowCounter returns a sliding-window-log limiter that allows
+// limit requests per window for each key.
+func NewSlidingWindowCounter(cfg *Config, limit int, window time.Duration) (*SlidingWindowCounter, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf("sliding window limit must be at least 1, got %d", limit)
+	}
+	if window < time.Millisecond {
+		return nil, fmt.Errorf("sliding window must be at least 1ms, got %v", window)
+	}
+
+	rc, err := NewRedisLimitCounter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &SlidingWindowCounter{
+		counter: rc,
+		limit:   limit,
+		window:  window,
+	}, nil
+}
+
+// Allow records a request for key if it is within the limit, returning
+// whether it was allowed and the number of requests in the current window.
+func (s *SlidingWindowCounter) Allow(key string) (bool, int, error) {
+	c := s.counter
+	now := c.clock().UnixMicro()
+
+	ctx, cancel := c.opContext(c.ctx)
+	defer cancel()
+
+	result, err := slidingWindowScript.Exec(ctx, c.client, []string{s.key(key)}, []string{
+		strconv.FormatInt(now, 10),
+		strconv.FormatInt(s.window.Microseconds(), 10),
+		strconv.Itoa(s.limit),
+		strconv.FormatInt(now, 10) + "-" + strconv.FormatUint(rand.Uint64(), 36),
+	}).AsIntSlice()
+	if err != nil {
+		return false, 0, fmt.Errorf("redis sliding window failed: %w", classify(err))
+	}
+
+	if err := checkReplies(len(result), 2); err != nil {
+		return false, 0, fmt.Errorf("redis sliding window failed: %w", err)
+	}
+
+	return result[0] == 1, int(result[1]), nil
+}
+
+// Close releases the underlying Redis client.
+func (s *SlidingWindowCounter) Close() error {
+	return s.counter.Close()
+}
+
+// key returns the sorted set key requests for key are logged to
+func (s *SlidingWindowCounter) key(key string) string {
+	return fmt.Sprintf("%slog:%d", s.counter.prefix, xxhash.Sum64String(key))
+}
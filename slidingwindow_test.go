@@ -0,0 +1,61 @@
+package httprateredis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestSlidingWindowCounter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	s, err := NewSlidingWindowCounter(&Config{Addresses: []string{mr.Addr()}, Clock: func() time.Time { return now }}, 3, time.Minute)
+	if err != nil {
+		t.Fatalf("NewSlidingWindowCounter: %v", err)
+	}
+	defer s.Close()
+
+	allow := func(wantAllowed bool, wantCount int) {
+		t.Helper()
+		allowed, count, err := s.Allow("key")
+		if err != nil || allowed != wantAllowed || count != wantCount {
+			t.Errorf("Allow at %v = %v, %d, %v, want %v, %d, nil", now.Sub(start), allowed, count, err, wantAllowed, wantCount)
+		}
+	}
+
+	allow(true, 1)
+	now = start.Add(30 * time.Second)
+	allow(true, 2)
+	now = start.Add(40 * time.Second)
+	allow(true, 3)
+	allow(false, 3)
+
+	// a denied request isn't logged
+	if members, _ := mr.ZMembers(s.key("key")); len(members) != 3 {
+		t.Errorf("logged %d requests, want 3", len(members))
+	}
+
+	// the first request leaves the window exactly a window later, and only
+	// it does
+	now = start.Add(time.Minute)
+	allow(true, 3)
+	allow(false, 3)
+
+	// other keys are counted separately
+	if allowed, count, err := s.Allow("other"); err != nil || !allowed || count != 1 {
+		t.Errorf("Allow of another key = %v, %d, %v, want true, 1, nil", allowed, count, err)
+	}
+}
+
+func TestNewSlidingWindowCounterValidates(t *testing.T) {
+	for _, tt := range []struct {
+		limit  int
+		window time.Duration
+	}{{0, time.Minute}, {-1, time.Minute}, {1, 0}, {1, -time.Second}, {1, time.Microsecond}} {
+		if _, err := NewSlidingWindowCounter(&Config{}, tt.limit, tt.window); err == nil {
+			t.Errorf("limit %d, window %v was accepted", tt.limit, tt.window)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package httprateredis
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrCrossSlot is returned by the calls running a script over several keys,
+// such as AllowWeighted, when the keys aren't in one Redis Cluster slot.
+// ClusterMode hash-tags the windows of a key so that they always are.
+var ErrCrossSlot = errors.New("keys are in different cluster slots")
+
+// checkSlot returns ErrCrossSlot unless keys are all in the slot of the
+// first one. Scripts need their keys in one slot on Redis Cluster, and
+// rueidis panics building a command whose keys aren't, so this is checked
+// whether or not the client is a cluster one.
+func checkSlot(keys ...string) error {
+	for _, key := range keys[1:] {
+		if keySlot(key) != keySlot(keys[0]) {
+			return fmt.Errorf("%w: %s and %s, set ClusterMode", ErrCrossSlot, keys[0], key)
+		}
+	}
+	return nil
+}
+
+// keySlot returns the Redis Cluster hash slot of key, honoring hash tags
+func keySlot(key string) uint16 {
+	if tag, ok := hashTag(key); ok {
+		key = tag
+	}
+	return crc16(key) & 16383
+}
+
+// hashTag returns the hash tag of key, the non-empty text between its first
+// '{' and the following '}', if it has one
+func hashTag(key string) (string, bool) {
+	s := strings.IndexByte(key, '{')
+	if s < 0 {
+		return "", false
+	}
+	e := strings.IndexByte(key[s+1:], '}')
+	if e <= 0 {
+		return "", false
+	}
+	return key[s+1 : s+1+e], true
+}
+
+// crc16 is the CRC16-CCITT (XMODEM) checksum Redis Cluster hashes keys with
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,36 @@
+package httprateredis
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want uint16
+	}{
+		// slots from CLUSTER KEYSLOT
+		{"foo", 12182},
+		{"{user1000}.following", 3443},
+		{"foo{}{bar}", 8363},
+	}
+	for _, tt := range tests {
+		if got := keySlot(tt.key); got != tt.want {
+			t.Errorf("keySlot(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+	if keySlot("{user1000}.following") != keySlot("{user1000}.followers") {
+		t.Error("keys sharing a hash tag are in different slots")
+	}
+}
+
+func TestCheckSlot(t *testing.T) {
+	if err := checkSlot("{key}:1", "{key}:2", "{key}:3"); err != nil {
+		t.Errorf("checkSlot of one hash tag = %v, want nil", err)
+	}
+	if err := checkSlot("{key}:1", "{key}:2", "foo"); !errors.Is(err, ErrCrossSlot) || !strings.Contains(err.Error(), "foo") {
+		t.Errorf("checkSlot across slots = %v, want ErrCrossSlot naming foo", err)
+	}
+}
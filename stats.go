@@ -0,0 +1,61 @@
+package httprateredis
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Stats is a snapshot of the counter's Redis activity.
+type Stats struct {
+	// Connected is whether the most recent Redis increment or get succeeded
+	Connected bool
+	// LastError is the most recent Redis increment or get error, if any
+	LastError error
+	// Increments and IncrementFailures count Redis increments and how many failed
+	Increments        int64
+	IncrementFailures int64
+	// Gets and GetFailures count Redis gets and how many failed
+	Gets        int64
+	GetFailures int64
+}
+
+type stats struct {
+	increments        atomic.Int64
+	incrementFailures atomic.Int64
+	gets              atomic.Int64
+	getFailures       atomic.Int64
+	disconnected      atomic.Bool
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+// record counts an operation and whether it failed
+func (s *stats) record(ops, failures *atomic.Int64, err error) {
+	ops.Add(1)
+	s.disconnected.Store(err != nil)
+	if err == nil {
+		return
+	}
+
+	failures.Add(1)
+	s.mu.Lock()
+	s.lastErr = err
+	s.mu.Unlock()
+}
+
+// Stats returns a snapshot of the counter's Redis activity.
+func (c *RedisLimitCounter) Stats() Stats {
+	c.stats.mu.Lock()
+	lastErr := c.stats.lastErr
+	c.stats.mu.Unlock()
+
+	return Stats{
+		Connected:         !c.stats.disconnected.Load(),
+		LastError:         lastErr,
+		Increments:        c.stats.increments.Load(),
+		IncrementFailures: c.stats.incrementFailures.Load(),
+		Gets:              c.stats.gets.Load(),
+		GetFailures:       c.stats.getFailures.Load(),
+	}
+}
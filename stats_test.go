@@ -0,0 +1,58 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rueian/rueidis"
+	"github.com/rueian/rueidis/mock"
+)
+
+func TestStats(t *testing.T) {
+	broken := false
+	result := func() rueidis.RedisResult {
+		if broken {
+			return mock.ErrorResult(errBroken)
+		}
+		return mock.Result(mock.RedisInt64(1))
+	}
+	client := mock.NewClient(gomock.NewController(t))
+	client.EXPECT().Do(gomock.Any(), gomock.Any()).DoAndReturn(func(context.Context, any) rueidis.RedisResult { return result() }).AnyTimes()
+	client.EXPECT().DoMulti(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, cmds ...any) []rueidis.RedisResult {
+		return []rueidis.RedisResult{result(), result()}
+	}).AnyTimes()
+	c := newRedisLimitCounter(client, &Config{})
+	c.Config(10, time.Minute)
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+
+	if s := c.Stats(); s != (Stats{Connected: true}) {
+		t.Errorf("Stats of a new counter = %+v, want only Connected", s)
+	}
+
+	c.Increment("key", now)
+	c.Increment("key", now)
+	c.Get("key", now, prev)
+	broken = true
+	c.Increment("key", now)
+	c.Get("key", now, prev)
+	c.Get("key", now, prev)
+
+	s := c.Stats()
+	if s.Increments != 3 || s.IncrementFailures != 1 || s.Gets != 3 || s.GetFailures != 2 {
+		t.Errorf("Stats = %+v, want 3 increments with 1 failure and 3 gets with 2 failures", s)
+	}
+	if s.Connected || !errors.Is(s.LastError, errBroken) {
+		t.Errorf("Stats after failures = connected %v, last error %v, want disconnected with errBroken", s.Connected, s.LastError)
+	}
+
+	// the last error is kept once Redis recovers
+	broken = false
+	c.Increment("key", now)
+	if s := c.Stats(); !s.Connected || !errors.Is(s.LastError, errBroken) || s.Increments != 4 {
+		t.Errorf("Stats after recovering = %+v, want connected with errBroken kept", s)
+	}
+}
@@ -0,0 +1,68 @@
+package httprateredis
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStrictExistingGet(t *testing.T) {
+	c, _ := newTestCounter(t, &Config{
+		StrictExisting: true,
+		MaxRetries:     3,
+		RetryBackoff:   time.Second,
+	})
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+
+	start := time.Now()
+	if _, _, err := c.Get("new", now, prev); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of a new key = %v, want ErrKeyNotFound", err)
+	}
+	// a missing key is an answer, retrying it would sleep through the backoff
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Get of a new key took %v, it was retried", elapsed)
+	}
+
+	if err := c.Increment("new", prev); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	curr, prevCount, err := c.Get("new", now, prev)
+	if err != nil {
+		t.Fatalf("Get with a previous window: %v", err)
+	}
+	if curr != 0 || prevCount != 1 {
+		t.Errorf("Get = %d, %d, want 0, 1", curr, prevCount)
+	}
+}
+
+func TestErrKeyNotFound(t *testing.T) {
+	c, _ := newTestCounter(t, &Config{StrictExisting: true})
+	now := time.Now().UTC().Truncate(time.Minute)
+	prev := now.Add(-time.Minute)
+
+	for name, get := range map[string]func() error{
+		"Get": func() error {
+			_, _, err := c.Get("missing", now, prev)
+			return err
+		},
+		"GetWindow": func() error {
+			_, _, err := c.GetWindow("missing", now, prev, time.Minute)
+			return err
+		},
+		"KeyTTL": func() error {
+			_, err := c.KeyTTL("missing")
+			return err
+		},
+	} {
+		err := get()
+		if !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("%s of a missing key = %v, want ErrKeyNotFound", name, err)
+		}
+		// it stays matchable once callers wrap it
+		if wrapped := fmt.Errorf("checking quota: %w", err); !errors.Is(wrapped, ErrKeyNotFound) {
+			t.Errorf("%s: wrapped %v doesn't match ErrKeyNotFound", name, wrapped)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package httprateredis
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// RedisTokenBucket limits requests with a token bucket per key, allowing a
+// sustained rate with bursts of up to burst requests. Buckets are refilled
+// and consumed atomically in Redis.
+type RedisTokenBucket struct {
+	counter *RedisLimitCounter
+	rate    float64
+	burst   int
+}
+
+// NewRedisTokenBucket returns a token bucket limiter that refills at rate
+// tokens per second up to a capacity of burst.
+func NewRedisTokenBucket(cfg *Config, rate float64, burst int) (*RedisTokenBucket, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("token bucket rate must be positive, got %v", rate)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("token bucket burst must be at least 1, got %d", burst)
+	}
+
+	rc, err := NewRedisLimitCounter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisTokenBucket{
+		counter: rc,
+		rate:    rate,
+		burst:   burst,
+	}, nil
+}
+
+// Allow takes a token from the bucket of key, returning whether one was
+// available and how many tokens remain.
+func (b *RedisTokenBucket) Allow(key string) (bool, int, error) {
+	c := b.counter
+
+	ctx, cancel := c.opContext(c.ctx)
+	defer cancel()
+
+	result, err := tokenBucketScript.Exec(ctx, c.client, []string{b.key(key)}, []string{
+		strconv.FormatFloat(b.rate, 'f', -1, 64),
+		strconv.Itoa(b.burst),
+		strconv.FormatInt(c.clock().UnixMicro(), 10),
+	}).AsIntSlice()
+	if err != nil {
+		return false, 0, fmt.Errorf("redis token bucket failed: %w", classify(err))
+	}
+
+	if err := checkReplies(len(result), 2); err != nil {
+		return false, 0, fmt.Errorf("redis token bucket failed: %w", err)
+	}
+
+	return result[0] == 1, int(result[1]), nil
+}
+
+// Close releases the underlying Redis client.
+func (b *RedisTokenBucket) Close() error {
+	return b.counter.Close()
+}
+
+// key returns the hash key the bucket of key is stored at
+func (b *RedisTokenBucket) key(key string) string {
+	return fmt.Sprintf("%sbucket:%d", b.counter.prefix, xxhash.Sum64String(key))
+}
@@ -0,0 +1,94 @@
+package httprateredis
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestBucket returns a token bucket on a new miniredis server, reading
+// the time from now
+func newTestBucket(t *testing.T, rate float64, burst int, now *time.Time) *RedisTokenBucket {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	b, err := NewRedisTokenBucket(&Config{Addresses: []string{mr.Addr()}, Clock: func() time.Time { return *now }}, rate, burst)
+	if err != nil {
+		t.Fatalf("NewRedisTokenBucket: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestRedisTokenBucket(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	b := newTestBucket(t, 2, 3, &now)
+
+	allow := func(wantAllowed bool, wantRemaining int) {
+		t.Helper()
+		allowed, remaining, err := b.Allow("key")
+		if err != nil || allowed != wantAllowed || remaining != wantRemaining {
+			t.Errorf("Allow at %v = %v, %d, %v, want %v, %d, nil", now.Sub(start), allowed, remaining, err, wantAllowed, wantRemaining)
+		}
+	}
+
+	// a new bucket is full, so takes a burst
+	allow(true, 2)
+	allow(true, 1)
+	allow(true, 0)
+	allow(false, 0)
+
+	// it refills at 2 tokens a second
+	now = start.Add(500 * time.Millisecond)
+	allow(true, 0)
+	allow(false, 0)
+
+	// and never beyond the burst
+	now = start.Add(time.Hour)
+	allow(true, 2)
+}
+
+func TestRedisTokenBucketConcurrent(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newTestBucket(t, 1, 10, &now)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := b.Allow("key")
+			if err != nil {
+				t.Errorf("Allow: %v", err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 10 {
+		t.Errorf("allowed %d concurrent requests, want the burst of 10", allowed)
+	}
+}
+
+func TestNewRedisTokenBucketValidates(t *testing.T) {
+	for _, tt := range []struct {
+		rate  float64
+		burst int
+	}{{0, 1}, {-1, 1}, {1, 0}} {
+		if _, err := NewRedisTokenBucket(&Config{}, tt.rate, tt.burst); err == nil {
+			t.Errorf("rate %v, burst %d was accepted", tt.rate, tt.burst)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package httprateredis
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LoadConfig reads a Config from a TOML file, using the fields' toml tags
+// and duration strings, like so:
+/*
+	addresses = ["127.0.0.1:6379"]
+	password = "secret"
+	timeout = "500ms"
+*/
+// Fields missing from the file are set to their defaults.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if _, err := toml.DecodeFile(path, cfg); err != nil {
+		return nil, fmt.Errorf("unable to load config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Addresses) == 0 {
+		cfg.Addresses = []string{DefaultAddress}
+	}
+	cfg.setDefaults()
+	return cfg, nil
+}
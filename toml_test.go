@@ -0,0 +1,68 @@
+package httprateredis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes body to a config file in a temp dir, returning its path
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "httprate.toml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+addresses = ["10.0.0.1:6379", "10.0.0.2:6379"]
+password = "secret"
+db_index = 2
+timeout = "500ms"
+use_hash_field = true
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(cfg.Addresses) != 2 || cfg.Addresses[1] != "10.0.0.2:6379" || cfg.Password != "secret" || cfg.DBIndex != 2 {
+		t.Errorf("LoadConfig = %+v", cfg)
+	}
+	if cfg.Timeout != 500*time.Millisecond || !cfg.UseHashField {
+		t.Errorf("timeout, use hash field = %v, %v, want 500ms, true", cfg.Timeout, cfg.UseHashField)
+	}
+	// fields missing from the file get their defaults
+	if cfg.PrefixKey != DefaultPrefix || cfg.ExpiryMultiplier != DefaultExpiryMultiplier {
+		t.Errorf("prefix, expiry multiplier = %q, %v, want the defaults", cfg.PrefixKey, cfg.ExpiryMultiplier)
+	}
+}
+
+func TestLoadConfigEmpty(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, ""))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(cfg.Addresses) != 1 || cfg.Addresses[0] != DefaultAddress {
+		t.Errorf("addresses = %v, want DefaultAddress", cfg.Addresses)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for name, tt := range map[string]struct {
+		path string
+		want string
+	}{
+		"missing":  {filepath.Join(t.TempDir(), "missing.toml"), "unable to load config"},
+		"syntax":   {writeConfig(t, "addresses = [\n"), "unable to load config"},
+		"duration": {writeConfig(t, `timeout = "soon"`), "unable to load config"},
+		"invalid":  {writeConfig(t, `addresses = ["redis"]`), "invalid config"},
+	} {
+		if _, err := LoadConfig(tt.path); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%s: LoadConfig = %v, want an error starting %q", name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package httprateredis
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rueian/rueidis"
+)
+
+// KeyCount is the count stored at a counter's Redis key.
+type KeyCount struct {
+	// RedisKey is the Redis key of one window of a rate-limit key, which is
+	// hashed so the rate-limit key itself can't be recovered
+	RedisKey string
+	Count    int
+}
+
+// TopKeys returns up to n window counters under the prefix with the
+// highest counts, highest first. It SCANs every master and reads every
+// counter, so it's a potentially expensive diagnostic; counts are
+// approximate as they keep changing while the scan runs, and include every
+// window that hasn't expired yet. Counters stored with UseHashField aren't
+// listed.
+func (c *RedisLimitCounter) TopKeys(ctx context.Context, n int) ([]KeyCount, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	// replicas hold copies of their master's keys, which would be listed twice
+	nodes, err := masterNodes(ctx, c.client)
+	if err != nil {
+		return nil, fmt.Errorf("redis top keys failed: %w", err)
+	}
+
+	top := &keyCountHeap{}
+	pattern := escapeGlob(c.prefix) + "*"
+	for _, node := range nodes {
+		if err := c.scanCounts(ctx, node, pattern, n, top); err != nil {
+			return nil, fmt.Errorf("redis top keys failed: %w", classify(err))
+		}
+	}
+
+	counts := []KeyCount(*top)
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Count > counts[j].Count })
+	return counts, nil
+}
+
+// scanCounts reads the counters matching pattern on node into top, keeping
+// the n highest
+func (c *RedisLimitCounter) scanCounts(ctx context.Context, node rueidis.Client, pattern string, n int, top *keyCountHeap) error {
+	var cursor uint64
+	for {
+		entry, err := node.Do(ctx, node.B().Scan().Cursor(cursor).Match(pattern).Count(100).Build()).AsScanEntry()
+		if err != nil {
+			return err
+		}
+
+		keys := make([]string, 0, len(entry.Elements))
+		gets := make(rueidis.Commands, 0, len(entry.Elements))
+		for _, key := range entry.Elements {
+			// idempotency markers aren't counters
+			if strings.Contains(key, ":idem:") {
+				continue
+			}
+			keys = append(keys, key)
+			gets = append(gets, c.client.B().Get().Key(key).Build())
+		}
+
+		if len(gets) > 0 {
+			for i, response := range c.client.DoMulti(ctx, gets...) {
+				count, err := response.AsInt64()
+				if err != nil {
+					var redisErr *rueidis.RedisError
+					// expired since the scan, or not a counter such as a
+					// sliding window log or token bucket
+					if errors.As(err, &redisErr) || response.Error() == nil {
+						continue
+					}
+					return err
+				}
+
+				heap.Push(top, KeyCount{RedisKey: keys[i], Count: int(count)})
+				if top.Len() > n {
+					heap.Pop(top)
+				}
+			}
+		}
+
+		if entry.Cursor == 0 {
+			return nil
+		}
+		cursor = entry.Cursor
+	}
+}
+
+// keyCountHeap is a min-heap of counts, so the lowest is popped first
+type keyCountHeap []KeyCount
+
+func (h keyCountHeap) Len() int           { return len(h) }
+func (h keyCountHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h keyCountHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *keyCountHeap) Push(x any) { *h = append(*h, x.(KeyCount)) }
+
+func (h *keyCountHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,44 @@
+package httprateredis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTopKeys(t *testing.T) {
+	// miniredis is run as a cluster, where the idempotency script needs
+	// hash-tagged keys
+	c, mr := newTestCounter(t, &Config{ClusterMode: true})
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	counts := map[string]int{"a": 5, "b": 1, "c": 3, "d": 4}
+	for key, n := range counts {
+		if err := c.IncrementBy(key, now, int64(n)); err != nil {
+			t.Fatalf("IncrementBy(%q): %v", key, err)
+		}
+	}
+	// neither an idempotency marker nor a key outside the prefix is listed
+	if _, err := c.IncrementIdempotent("a", "request", now); err != nil {
+		t.Fatalf("IncrementIdempotent: %v", err)
+	}
+	mr.Set("other", "100")
+
+	top, err := c.TopKeys(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("TopKeys: %v", err)
+	}
+	want := []KeyCount{
+		{c.limitCounterKey("a", now), 6},
+		{c.limitCounterKey("d", now), 4},
+		{c.limitCounterKey("c", now), 3},
+	}
+	if len(top) != len(want) {
+		t.Fatalf("TopKeys = %v, want %v", top, want)
+	}
+	for i := range want {
+		if top[i] != want[i] {
+			t.Errorf("TopKeys[%d] = %v, want %v", i, top[i], want[i])
+		}
+	}
+}
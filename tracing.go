@@ -0,0 +1,38 @@
+package httprateredis
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts a span for a counter operation under ctx, returning ctx
+// and a nil span when no tracer is configured
+func (c *RedisLimitCounter) startSpan(ctx context.Context, name, command string, window time.Time) (context.Context, trace.Span) {
+	if c.tracer == nil {
+		return ctx, nil
+	}
+	return c.tracer.Start(ctx, "httprateredis."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", command),
+			attribute.Int64("httprate.window", window.Unix()),
+		),
+	)
+}
+
+// endSpan records err on span and ends it
+func endSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,129 @@
+package httprateredis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordedSpan is a span recording what the counter does with it
+type recordedSpan struct {
+	trace.Span
+	name   string
+	attrs  []attribute.KeyValue
+	status codes.Code
+	errs   []error
+	ended  bool
+}
+
+func (s *recordedSpan) RecordError(err error, _ ...trace.EventOption) { s.errs = append(s.errs, err) }
+func (s *recordedSpan) SetStatus(code codes.Code, _ string)           { s.status = code }
+func (s *recordedSpan) End(...trace.SpanEndOption)                    { s.ended = true }
+
+// spanRecorder is a Tracer keeping every span it starts
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	span := &recordedSpan{Span: trace.SpanFromContext(ctx), name: name, attrs: cfg.Attributes()}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// attr returns the value of the attribute named key on s
+func (s *recordedSpan) attr(key attribute.Key) attribute.Value {
+	for _, kv := range s.attrs {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &spanRecorder{}
+	c, _ := newTestCounter(t, &Config{Tracer: tracer})
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	if err := c.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if _, _, err := c.Get("key", now, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("started %d spans, want 2", len(tracer.spans))
+	}
+	for i, want := range []struct{ name, op string }{
+		{"httprateredis.Increment", "EVALSHA"},
+		{"httprateredis.Get", "GET"},
+	} {
+		span := tracer.spans[i]
+		if span.name != want.name || span.attr("db.operation").AsString() != want.op {
+			t.Errorf("span %d = %s with db.operation %q, want %s with %q", i, span.name, span.attr("db.operation").AsString(), want.name, want.op)
+		}
+		if got := span.attr("httprate.window").AsInt64(); got != now.Unix() {
+			t.Errorf("span %d httprate.window = %d, want %d", i, got, now.Unix())
+		}
+		if !span.ended || span.status == codes.Error || len(span.errs) != 0 {
+			t.Errorf("span %d ended %v with status %v and errors %v, want ended without errors", i, span.ended, span.status, span.errs)
+		}
+	}
+}
+
+func TestTracerRecordsErrors(t *testing.T) {
+	tracer := &spanRecorder{}
+	c := newRedisLimitCounter(failingClient(t), &Config{Tracer: tracer})
+	c.Config(10, time.Minute)
+
+	c.Increment("key", time.Now())
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("started %d spans, want 1", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	if !span.ended || span.status != codes.Error || len(span.errs) != 1 {
+		t.Errorf("span ended %v with status %v and errors %v, want ended with one error", span.ended, span.status, span.errs)
+	}
+}
+
+func TestTracerOperation(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		cfg       Config
+		functions bool
+		want      string
+	}{
+		{"script", Config{}, false, "EVALSHA"},
+		{"no ttl", Config{DisableTTL: true}, false, "INCRBY"},
+		{"functions", Config{}, true, "FCALL"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &spanRecorder{}
+			tt.cfg.Tracer = tracer
+			c := newRedisLimitCounter(failingClient(t), &tt.cfg)
+			c.functions = tt.functions
+			c.Config(10, time.Minute)
+
+			c.Increment("key", time.Now())
+			if len(tracer.spans) != 1 {
+				t.Fatalf("started %d spans, want 1", len(tracer.spans))
+			}
+			if got := tracer.spans[0].attr("db.operation").AsString(); got != tt.want {
+				t.Errorf("db.operation = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package httprateredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/rueian/rueidis"
+)
+
+// Warmup dials up to conns pipelined connections to every Redis node,
+// including those of ReadAddresses, ahead of traffic, so the first requests
+// don't pay for connecting. rueidis opens 2^PipelineMultiplex connections
+// per node lazily, picking one by the slot of each command's key, so Warmup
+// sends a read-only EXISTS for keys under the prefix covering the first
+// conns slots. It returns early with the context's error if ctx is done
+// first.
+func (c *RedisLimitCounter) Warmup(ctx context.Context, conns int) error {
+	if conns <= 0 {
+		return nil
+	}
+	keys := warmupKeys(c.prefix, conns)
+
+	clients := []rueidis.Client{c.client}
+	if c.reader != c.client {
+		clients = append(clients, c.reader)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 1)
+	for _, client := range clients {
+		for addr, node := range client.Nodes() {
+			for _, key := range keys {
+				wg.Add(1)
+				go func(addr string, node rueidis.Client, key string) {
+					defer wg.Done()
+
+					err := node.Do(ctx, node.B().Exists().Key(key).Build()).Error()
+					var redisErr *rueidis.RedisError
+					// MOVED and the like still needed a connection to answer
+					if err != nil && !errors.As(err, &redisErr) {
+						select {
+						case errs <- fmt.Errorf("redis warmup of %s failed: %w", addr, classify(err)):
+						default:
+						}
+					}
+				}(addr, node, key)
+			}
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("redis warmup failed: %w", ctx.Err())
+	case <-done:
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// warmupKeys returns keys under prefix in each of the slots 0 to n-1. A
+// prefix holding a hash tag pins every key to the slot of its tag, so there
+// is then only the one key to return.
+func warmupKeys(prefix string, n int) []string {
+	if _, ok := hashTag(prefix); ok {
+		return []string{prefix + "warmup"}
+	}
+	if n > 16384 {
+		n = 16384
+	}
+
+	keys := make([]string, n)
+	found := 0
+	for i := 0; found < n; i++ {
+		key := prefix + "warmup:" + strconv.Itoa(i)
+		if s := keySlot(key); int(s) < n && keys[s] == "" {
+			keys[s] = key
+			found++
+		}
+	}
+	return keys
+}
@@ -0,0 +1,41 @@
+package httprateredis
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWarmupKeysCoverSlots(t *testing.T) {
+	keys := warmupKeys(DefaultPrefix, 8)
+	if len(keys) != 8 {
+		t.Fatalf("got %d keys, want 8", len(keys))
+	}
+	for i, key := range keys {
+		if slot := keySlot(key); int(slot) != i {
+			t.Errorf("key %q is in slot %d, want %d", key, slot, i)
+		}
+	}
+}
+
+func TestWarmupKeysHashTaggedPrefix(t *testing.T) {
+	// every key under a hash-tagged prefix is in the same slot, which used
+	// to make the search for other slots loop forever
+	keys := warmupKeys("httprate:{svc}:", 8)
+	if len(keys) != 1 {
+		t.Fatalf("got %d keys, want 1", len(keys))
+	}
+	if got, want := keySlot(keys[0]), keySlot("svc"); got != want {
+		t.Errorf("key %q is in slot %d, want %d", keys[0], got, want)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	c, mr := newTestCounter(t, &Config{PrefixKey: "httprate:{svc}:"})
+
+	if err := c.Warmup(context.Background(), 4); err != nil {
+		t.Fatalf("Warmup: %v", err)
+	}
+	if n := mr.CurrentConnectionCount(); n == 0 {
+		t.Error("Warmup opened no connections")
+	}
+}
@@ -0,0 +1,95 @@
+package httprateredis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestIncrementWindowLengths(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c, mr := newTestCounter(t, &Config{Clock: fixedClock(now)})
+
+	// a 10 minute and an hour window both start at noon
+	for _, window := range []time.Duration{10 * time.Minute, time.Hour, time.Hour} {
+		if err := c.IncrementWindow("key", now, window); err != nil {
+			t.Fatalf("IncrementWindow(%v): %v", window, err)
+		}
+	}
+
+	tenMinutes, _ := c.counterKey("key", now, 10*time.Minute)
+	hour, _ := c.counterKey("key", now, time.Hour)
+	if tenMinutes == hour {
+		t.Fatalf("windows of 10m and 1h share key %q", hour)
+	}
+	if got, want := mr.TTL(tenMinutes), 30*time.Minute; got != want {
+		t.Errorf("TTL of the 10m window = %v, want %v", got, want)
+	}
+	if got, want := mr.TTL(hour), 3*time.Hour; got != want {
+		t.Errorf("TTL of the 1h window = %v, want %v", got, want)
+	}
+
+	for window, want := range map[time.Duration]int{10 * time.Minute: 1, time.Hour: 2} {
+		curr, _, err := c.GetWindow("key", now, now.Add(-window), window)
+		if err != nil {
+			t.Fatalf("GetWindow(%v): %v", window, err)
+		}
+		if curr != want {
+			t.Errorf("GetWindow(%v) = %d, want %d", window, curr, want)
+		}
+	}
+}
+
+func TestIncrementWindowConfiguredLength(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c, _ := newTestCounter(t, &Config{Clock: fixedClock(now)})
+
+	// the configured window is counted together with Increment
+	if err := c.Increment("key", now); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if err := c.IncrementWindow("key", now, time.Minute); err != nil {
+		t.Fatalf("IncrementWindow: %v", err)
+	}
+	curr, _, err := c.Get("key", now, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if curr != 2 {
+		t.Errorf("Get = %d, want 2", curr)
+	}
+}
+
+func TestZeroWindowGuard(t *testing.T) {
+	mr := miniredis.RunT(t)
+	// not configured, as if httprate never called Config
+	c, err := NewRedisLimitCounter(&Config{Addresses: []string{mr.Addr()}})
+	if err != nil {
+		t.Fatalf("NewRedisLimitCounter: %v", err)
+	}
+	defer c.Close()
+	now := time.Now()
+
+	if err := c.Increment("key", now); err == nil {
+		t.Error("Increment before Config succeeded")
+	}
+	if err := c.IncrementBy("key", now, 2); err == nil {
+		t.Error("IncrementBy before Config succeeded")
+	}
+	if err := c.IncrementWindow("key", now, 0); err == nil {
+		t.Error("IncrementWindow with a zero window succeeded")
+	}
+	if _, _, err := c.GetWindow("key", now, now, -time.Second); err == nil {
+		t.Error("GetWindow with a negative window succeeded")
+	}
+	c.Config(10, 0)
+	if err := c.Increment("key", now); err == nil {
+		t.Error("Increment after Config with a zero window succeeded")
+	}
+
+	// nothing was written, so nothing was written without a TTL either
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("keys = %v, want none", keys)
+	}
+}